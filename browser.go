@@ -0,0 +1,95 @@
+package goscrapy
+
+import "time"
+
+// BrowserActionType represents the type of browser action
+type BrowserActionType string
+
+// all supported browser actions
+const (
+	ActionWaitSelector    BrowserActionType = "wait_selector"     // wait until selector matched
+	ActionWaitNetworkIdle BrowserActionType = "wait_network_idle" // wait until no more network activities
+	ActionClick           BrowserActionType = "click"             // click on element
+	ActionType            BrowserActionType = "type"              // type text into element
+	ActionScrollToBottom  BrowserActionType = "scroll_to_bottom"  // scroll to the bottom of page
+	ActionExecuteScript   BrowserActionType = "execute_script"    // execute javascript
+)
+
+// BrowserAction represents an action performed by browser based downloader after
+// loading page and before capturing the DOM. Actions only mean something when using
+// a browser based downloader, other downloaders will simply ignore them.
+//
+// Selector could be either a CSS selector or an XPath expression, it will be treated
+// as XPath if starting with "/" or "(".
+type BrowserAction struct {
+	Type     BrowserActionType `json:"type"`
+	Selector string            `json:"selector,omitempty"`
+	// Text is the text to type for ActionType.
+	Text string `json:"text,omitempty"`
+	// Script is the javascript to execute for ActionExecuteScript, the result
+	// will be stored into Response.ScriptResults with the key of Name.
+	Script string        `json:"script,omitempty"`
+	Args   []interface{} `json:"args,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	// Times is the number of times to scroll for ActionScrollToBottom.
+	Times int `json:"times,omitempty"`
+	// Interval is the duration to wait between two scrolls for ActionScrollToBottom,
+	// or the duration without loading request to be considered idle for ActionWaitNetworkIdle.
+	Interval time.Duration `json:"interval,omitempty"`
+	// Timeout is the maximum duration to wait for ActionWaitSelector and ActionWaitNetworkIdle.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// WaitForSelector returns an action that waits until the selector matches any element.
+func WaitForSelector(selector string, timeout time.Duration) BrowserAction {
+	return BrowserAction{Type: ActionWaitSelector, Selector: selector, Timeout: timeout}
+}
+
+// WaitForNetworkIdle returns an action that waits until there is no request
+// loading for at least the duration of idle.
+func WaitForNetworkIdle(idle, timeout time.Duration) BrowserAction {
+	return BrowserAction{Type: ActionWaitNetworkIdle, Interval: idle, Timeout: timeout}
+}
+
+// Click returns an action that clicks on the element matched by selector.
+func Click(selector string) BrowserAction {
+	return BrowserAction{Type: ActionClick, Selector: selector}
+}
+
+// Type returns an action that types text into the element matched by selector.
+func Type(selector string, text string) BrowserAction {
+	return BrowserAction{Type: ActionType, Selector: selector, Text: text}
+}
+
+// ScrollToBottom returns an action that scrolls to the bottom of page n times, it's
+// useful for loading pages with infinite scroll.
+func ScrollToBottom(n int, interval time.Duration) BrowserAction {
+	return BrowserAction{Type: ActionScrollToBottom, Times: n, Interval: interval}
+}
+
+// ExecuteScript returns an action that executes javascript, the result of script will
+// be stored into Response.ScriptResults with the key of name.
+func ExecuteScript(name string, script string, args ...interface{}) BrowserAction {
+	return BrowserAction{Type: ActionExecuteScript, Name: name, Script: script, Args: args}
+}
+
+// CaptureOptions specifies the visual evidences captured by browser based downloader
+// after performing browser actions.
+type CaptureOptions struct {
+	// Screenshot captures a screenshot of page in PNG format, named as "screenshot.png".
+	Screenshot bool `json:"screenshot,omitempty"`
+	// FullPage captures the whole page instead of the visible viewport.
+	FullPage bool `json:"full_page,omitempty"`
+	// Selector captures the screenshot of the element matched by selector (CSS
+	// selector or XPath) instead of page, named as "element.png".
+	Selector string `json:"selector,omitempty"`
+	// PDF prints page into PDF, named as "page.pdf". It only works in headless mode.
+	PDF bool `json:"pdf,omitempty"`
+}
+
+// Artifact represents a file captured while downloading, e.g. screenshot.
+type Artifact struct {
+	Name        string `json:"name"`         // e.g. "screenshot.png"
+	ContentType string `json:"content_type"` // e.g. "image/png"
+	Data        []byte `json:"-"`
+}
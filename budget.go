@@ -0,0 +1,117 @@
+package goscrapy
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBudgetExhausted is returned by Engine.Download once the budget of all spiders has been exhausted.
+var ErrBudgetExhausted = errors.New("crawling budget exhausted")
+
+// reasons of closing spider when budget has been exhausted
+const (
+	CloseReasonMaxResponses = "max_responses" // received responses reached Budget.MaxResponses
+	CloseReasonMaxItems     = "max_items"     // scraped items reached Budget.MaxItems
+	CloseReasonMaxErrors    = "max_errors"    // errors reached Budget.MaxErrors
+	CloseReasonMaxBytes     = "max_bytes"     // downloaded bytes reached Budget.MaxBytes
+	CloseReasonTimeout      = "timeout"       // crawling time reached Budget.Timeout
+)
+
+// Budget limits crawling, zero means no limit. Once any limit has been reached, no more
+// requests will be scheduled and spiders will be closed with the corresponding reason.
+type Budget struct {
+	MaxResponses int64         // max number of received responses
+	MaxItems     int64         // max number of scraped items, excluding dropped ones
+	MaxErrors    int64         // max number of errors, including downloading and parsing errors
+	MaxBytes     int64         // max bytes of downloaded response bodies
+	Timeout      time.Duration // max crawling time since spider has been opened
+}
+
+// BudgetSpider is an optional interface implemented by spiders that limit their own crawling,
+// the spider will be closed once its budget has been exhausted while other spiders continue
+// crawling. For limiting crawling of all spiders, using engine option WithBudget.
+type BudgetSpider interface {
+	Budget() Budget
+}
+
+// WithBudget returns an Option that limits crawling of all spiders, engine will stop and close
+// all spiders with the corresponding reason once budget has been exhausted.
+func WithBudget(budget Budget) Option {
+	return func(e *Engine) {
+		e.budget = budget
+	}
+}
+
+// budgetUsage counts usage of budget.
+type budgetUsage struct {
+	responses int64
+	items     int64
+	errors    int64
+	bytes     int64
+}
+
+// exceeded returns the close reason if any limit of budget has been reached.
+func (b Budget) exceeded(u *budgetUsage) string {
+	switch {
+	case b.MaxResponses > 0 && atomic.LoadInt64(&u.responses) >= b.MaxResponses:
+		return CloseReasonMaxResponses
+	case b.MaxItems > 0 && atomic.LoadInt64(&u.items) >= b.MaxItems:
+		return CloseReasonMaxItems
+	case b.MaxErrors > 0 && atomic.LoadInt64(&u.errors) >= b.MaxErrors:
+		return CloseReasonMaxErrors
+	case b.MaxBytes > 0 && atomic.LoadInt64(&u.bytes) >= b.MaxBytes:
+		return CloseReasonMaxBytes
+	default:
+		return ""
+	}
+}
+
+// startBudgetTimers closes spiders or stops engine once their timeout has been reached.
+// It returns a function that stops all timers.
+func (e *Engine) startBudgetTimers(ctx context.Context) func() {
+	var timers []*time.Timer
+	if e.budget.Timeout > 0 {
+		timers = append(timers, time.AfterFunc(e.budget.Timeout, func() {
+			e.lg.Infof(ctx, "crawling timeout [%s] has been reached", e.budget.Timeout)
+			e.stop(CloseReasonTimeout)
+		}))
+	}
+
+	for _, st := range e.openedSpiders() {
+		name := st.spider.Name()
+		if timeout := st.budget.Timeout; timeout > 0 {
+			timers = append(timers, time.AfterFunc(timeout, func() {
+				e.CloseSpider(name, CloseReasonTimeout)
+			}))
+		}
+	}
+
+	return func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}
+}
+
+// useBudget records usage of budget for spider and all spiders, spider will be closed or
+// engine will be stopped once budget has been exhausted.
+func (e *Engine) useBudget(ctx context.Context, spiderName string, fn func(u *budgetUsage)) {
+	fn(&e.usage)
+	if reason := e.budget.exceeded(&e.usage); reason != "" {
+		if e.stop(reason) {
+			e.lg.Infof(ctx, "crawling budget has been exhausted: %s", reason)
+		}
+	}
+
+	st := e.getSpiderState(spiderName)
+	if st == nil {
+		return
+	}
+
+	fn(&st.usage)
+	if reason := st.budget.exceeded(&st.usage); reason != "" {
+		e.CloseSpider(spiderName, reason)
+	}
+}
@@ -0,0 +1,153 @@
+package goscrapy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBudgetExceeded(t *testing.T) {
+	cases := []struct {
+		name   string
+		budget Budget
+		usage  budgetUsage
+		want   string
+	}{
+		{name: "no limit", budget: Budget{}, usage: budgetUsage{responses: 100, items: 100, errors: 100, bytes: 100}, want: ""},
+		{name: "under limits", budget: Budget{MaxResponses: 10, MaxItems: 10, MaxErrors: 10, MaxBytes: 10}, usage: budgetUsage{responses: 9, items: 9, errors: 9, bytes: 9}, want: ""},
+		{name: "max responses", budget: Budget{MaxResponses: 10}, usage: budgetUsage{responses: 10}, want: CloseReasonMaxResponses},
+		{name: "max items", budget: Budget{MaxItems: 10}, usage: budgetUsage{items: 11}, want: CloseReasonMaxItems},
+		{name: "max errors", budget: Budget{MaxErrors: 1}, usage: budgetUsage{errors: 1}, want: CloseReasonMaxErrors},
+		{name: "max bytes", budget: Budget{MaxBytes: 1024}, usage: budgetUsage{bytes: 2048}, want: CloseReasonMaxBytes},
+		{name: "first reached limit in order", budget: Budget{MaxResponses: 1, MaxBytes: 1}, usage: budgetUsage{responses: 1, bytes: 1}, want: CloseReasonMaxResponses},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.budget.exceeded(&c.usage); got != c.want {
+				t.Errorf("exceeded() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+// budgetSpider requests seeds pages of server, it's closed with the budget.
+type budgetSpider struct {
+	name   string
+	prefix string
+	seeds  int
+	budget Budget
+
+	mux    sync.Mutex
+	reason string
+}
+
+func (s *budgetSpider) Name() string { return s.name }
+
+func (s *budgetSpider) URLMatcher() URLMatcher {
+	return NewRegexpMatcher("^" + regexp.QuoteMeta(s.prefix) + "/")
+}
+
+func (s *budgetSpider) StartRequests() []*Request {
+	var reqs []*Request
+	for i := 0; i < s.seeds; i++ {
+		reqs = append(reqs, &Request{URL: fmt.Sprintf("%s/%d", s.prefix, i)})
+	}
+	return reqs
+}
+
+func (s *budgetSpider) Parse(ctx *Context) (*Items, []*Request, error) {
+	return nil, nil, nil
+}
+
+func (s *budgetSpider) Budget() Budget { return s.budget }
+
+func (s *budgetSpider) Closed(ctx context.Context, reason string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.reason = reason
+}
+
+func (s *budgetSpider) closeReason() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.reason
+}
+
+func newBudgetServer(hits map[string]*int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for prefix, n := range hits {
+			if len(r.URL.Path) > len(prefix) && r.URL.Path[:len(prefix)+1] == prefix+"/" {
+				atomic.AddInt64(n, 1)
+			}
+		}
+		fmt.Fprint(w, "<html></html>")
+	}))
+}
+
+func TestEngineGlobalBudget(t *testing.T) {
+	var hits int64
+	srv := newBudgetServer(map[string]*int64{"/a": &hits})
+	defer srv.Close()
+
+	const concurrency = 2
+	spider := &budgetSpider{name: "a", prefix: srv.URL + "/a", seeds: 50}
+	e := New(SetConcurrency(concurrency), WithBudget(Budget{MaxResponses: 3}))
+	e.RegisterSipders(spider)
+	if err := e.Run(); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	// requests being downloaded when budget exhausted are allowed to finish
+	if n := atomic.LoadInt64(&hits); n < 3 || n > 3+concurrency {
+		t.Errorf("downloaded %d pages, want 3 to %d", n, 3+concurrency)
+	}
+
+	if got := e.StopReason(); got != CloseReasonMaxResponses {
+		t.Errorf("StopReason() = %q, want %q", got, CloseReasonMaxResponses)
+	}
+
+	if got := spider.closeReason(); got != CloseReasonMaxResponses {
+		t.Errorf("spider closed with %q, want %q", got, CloseReasonMaxResponses)
+	}
+}
+
+func TestEngineSpiderBudget(t *testing.T) {
+	var hitsA, hitsB int64
+	srv := newBudgetServer(map[string]*int64{"/a": &hitsA, "/b": &hitsB})
+	defer srv.Close()
+
+	const concurrency = 2
+	limited := &budgetSpider{name: "a", prefix: srv.URL + "/a", seeds: 50, budget: Budget{MaxResponses: 3}}
+	unlimited := &budgetSpider{name: "b", prefix: srv.URL + "/b", seeds: 10}
+	e := New(SetConcurrency(concurrency))
+	e.RegisterSipders(limited, unlimited)
+	if err := e.Run(); err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+
+	if n := atomic.LoadInt64(&hitsA); n < 3 || n > 3+concurrency {
+		t.Errorf("limited spider downloaded %d pages, want 3 to %d", n, 3+concurrency)
+	}
+
+	if n := atomic.LoadInt64(&hitsB); n != 10 {
+		t.Errorf("unlimited spider downloaded %d pages, want 10", n)
+	}
+
+	if got := limited.closeReason(); got != CloseReasonMaxResponses {
+		t.Errorf("limited spider closed with %q, want %q", got, CloseReasonMaxResponses)
+	}
+
+	if got := unlimited.closeReason(); got != CloseReasonFinished {
+		t.Errorf("unlimited spider closed with %q, want %q", got, CloseReasonFinished)
+	}
+
+	if got := e.StopReason(); got != CloseReasonFinished {
+		t.Errorf("StopReason() = %q, want %q", got, CloseReasonFinished)
+	}
+}
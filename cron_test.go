@@ -0,0 +1,81 @@
+package goscrapy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.Local)
+	}
+
+	// 2026-01-01 is Thursday
+	cases := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{expr: "* * * * *", from: date(2026, 1, 1, 10, 0, 30), want: date(2026, 1, 1, 10, 1, 0)},
+		{expr: "15,45 * * * *", from: date(2026, 1, 1, 10, 20, 0), want: date(2026, 1, 1, 10, 45, 0)},
+		{expr: "15,45 * * * *", from: date(2026, 1, 1, 10, 45, 0), want: date(2026, 1, 1, 11, 15, 0)},
+		{expr: "5/15 * * * *", from: date(2026, 1, 1, 10, 21, 0), want: date(2026, 1, 1, 10, 35, 0)},
+		{expr: "30 */2 * * *", from: date(2026, 1, 1, 1, 0, 0), want: date(2026, 1, 1, 2, 30, 0)},
+		{expr: "0 9 * * 1-5", from: date(2026, 1, 2, 10, 0, 0), want: date(2026, 1, 5, 9, 0, 0)},
+		{expr: "0 12 */10 * *", from: date(2026, 1, 1, 13, 0, 0), want: date(2026, 1, 11, 12, 0, 0)},
+		{expr: "0 0 1 3 *", from: date(2026, 1, 1, 0, 0, 0), want: date(2026, 3, 1, 0, 0, 0)},
+		{expr: "0 0 * * 7", from: date(2026, 1, 1, 0, 0, 0), want: date(2026, 1, 4, 0, 0, 0)},
+		{expr: "0 0 13 * 5", from: date(2026, 1, 1, 0, 0, 0), want: date(2026, 1, 2, 0, 0, 0)},
+		{expr: "0 0 29 2 *", from: date(2026, 1, 1, 0, 0, 0), want: date(2028, 2, 29, 0, 0, 0)},
+		{expr: "@hourly", from: date(2026, 1, 1, 10, 15, 0), want: date(2026, 1, 1, 11, 0, 0)},
+		{expr: "@daily", from: date(2026, 1, 1, 10, 0, 0), want: date(2026, 1, 2, 0, 0, 0)},
+		{expr: "@weekly", from: date(2026, 1, 1, 10, 0, 0), want: date(2026, 1, 4, 0, 0, 0)},
+		{expr: "@monthly", from: date(2026, 1, 31, 10, 0, 0), want: date(2026, 2, 1, 0, 0, 0)},
+		{expr: "@yearly", from: date(2026, 1, 1, 0, 0, 0), want: date(2027, 1, 1, 0, 0, 0)},
+		{expr: "@every 10m", from: date(2026, 1, 1, 10, 0, 30), want: date(2026, 1, 1, 10, 10, 30)},
+		{expr: "0 0 30 2 *", from: date(2026, 1, 1, 0, 0, 0), want: time.Time{}},
+	}
+
+	for _, c := range cases {
+		s, err := ParseCron(c.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) error: %v", c.expr, err)
+			continue
+		}
+
+		if got := s.Next(c.from); !got.Equal(c.want) {
+			t.Errorf("ParseCron(%q).Next(%s) = %s, want %s", c.expr, c.from, got, c.want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"a * * * *",
+		"5-1 * * * *",
+		"1-a * * * *",
+		"@every x",
+		"@every -1m",
+		"@unknown",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestEvery(t *testing.T) {
+	from := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	if got, want := Every(time.Hour).Next(from), from.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("Every(1h).Next(%s) = %s, want %s", from, got, want)
+	}
+}
@@ -3,8 +3,10 @@ package goscrapy
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -77,6 +79,104 @@ func (dd *DefaultDownloader) makeRequest(ctx context.Context, req *Request) (*ht
 	}
 
 	r.Header = req.Header
-	r.URL.RawQuery = req.Query.Encode()
+	if len(req.Query) > 0 {
+		r.URL.RawQuery = req.Query.Encode()
+	}
 	return r, nil
 }
+
+var _ Downloader = &RouterDownloader{}
+
+// RouterDownloader is a downloader that routes requests to one of named downloaders, so that
+// different requests could be downloaded in different ways (e.g. rendering product pages with
+// chrome while downloading the others with http client).
+//
+// Downloader is selected in the following order:
+//  1. Request.Downloader if specified.
+//  2. The first URL rule that matches request url.
+//  3. The spider rule that matches the spider generating request.
+//  4. The default downloader.
+type RouterDownloader struct {
+	defaultName string
+	downloaders map[string]Downloader
+	urlRules    []urlRoute
+	spiderRules map[string]string
+	mux         sync.RWMutex
+}
+
+type urlRoute struct {
+	matcher URLMatcher
+	name    string
+}
+
+// NewRouterDownloader creates a router downloader with the default downloader, which
+// will be used if no other downloader is selected.
+func NewRouterDownloader(defaultName string, defaultDownloader Downloader) *RouterDownloader {
+	return &RouterDownloader{
+		defaultName: defaultName,
+		downloaders: map[string]Downloader{
+			defaultName: defaultDownloader,
+		},
+		spiderRules: make(map[string]string),
+	}
+}
+
+// Register registers a downloader with name.
+func (rd *RouterDownloader) Register(name string, d Downloader) {
+	rd.mux.Lock()
+	defer rd.mux.Unlock()
+
+	rd.downloaders[name] = d
+}
+
+// RouteURL routes requests with url matched by matcher to the named downloader.
+func (rd *RouterDownloader) RouteURL(matcher URLMatcher, name string) {
+	rd.mux.Lock()
+	defer rd.mux.Unlock()
+
+	rd.urlRules = append(rd.urlRules, urlRoute{matcher: matcher, name: name})
+}
+
+// RouteSpider routes requests generated by spider to the named downloader.
+func (rd *RouterDownloader) RouteSpider(spiderName string, name string) {
+	rd.mux.Lock()
+	defer rd.mux.Unlock()
+
+	rd.spiderRules[spiderName] = name
+}
+
+// Download downloads request using the selected downloader.
+func (rd *RouterDownloader) Download(req *Request) (*Response, error) {
+	name := rd.route(req)
+
+	rd.mux.RLock()
+	d, ok := rd.downloaders[name]
+	rd.mux.RUnlock()
+
+	if !ok || d == nil {
+		return nil, fmt.Errorf("downloader not found: %s", name)
+	}
+
+	return d.Download(req)
+}
+
+func (rd *RouterDownloader) route(req *Request) string {
+	if req.Downloader != "" {
+		return req.Downloader
+	}
+
+	rd.mux.RLock()
+	defer rd.mux.RUnlock()
+
+	for _, rule := range rd.urlRules {
+		if rule.matcher.Match(req.URL) {
+			return rule.name
+		}
+	}
+
+	if name, ok := rd.spiderRules[req.SpiderName()]; ok {
+		return name
+	}
+
+	return rd.defaultName
+}
@@ -2,7 +2,13 @@ package goscrapy
 
 import (
 	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,23 +23,35 @@ const (
 	stateRunning
 )
 
+// ErrRequestAborted is returned by Engine.Download if request has been aborted by middlewares.
+var ErrRequestAborted = errors.New("request aborted")
+
 // Engine represents scraping engine, it is responsible for managing
 // the data flow among scheduler, downloader and spiders.
 type Engine struct {
-	sched       Scheduler
-	downloader  Downloader
-	spiders     []Spider
-	pipelines   map[string][]Pipeline
-	concurrency int
-	lg          logger.Logger
-	mux         sync.RWMutex
-	state       int
-	pendingCnt  int32 // pendingCnt represents how many workers are waiting to handle request
+	sched        Scheduler
+	downloader   Downloader
+	spiders      []Spider
+	pipelines    map[string][]Pipeline // pipelines of every item name, sorted by priority
+	pipelineSet  []Pipeline            // all registered pipelines in order of registration
+	spiderStates map[string]*spiderState
+	stopReason   string     // guarded by stopMux
+	stopMux      sync.Mutex // serializes stopping, so that engine is stopped only once
+	stats        *Stats
+	concurrency  int
+	lg           logger.Logger
+	mux          sync.RWMutex
+	state        int32 // stateRunning or stateStoped, accessed atomically
+	pendingCnt   int32 // pendingCnt represents how many workers are waiting to handle request
 
 	requestHandlers  []RequestHandleFunc
 	responseHandlers []ResponseHandleFunc
-	maxCrawlingDepth int           // max crawling depth, no limit if less or equals to 0
-	delay            time.Duration // delay is the duration to wait before handling next request
+	maxCrawlingDepth int              // max crawling depth, no limit if less or equals to 0
+	keepAlive        bool             // true if waiting for next runs of recurring spiders
+	canonicalizer    URLCanonicalizer // canonicalizes urls of requests if not nil
+	delay            time.Duration    // delay is the duration to wait before handling next request
+	budget           Budget           // budget of all spiders
+	usage            budgetUsage
 }
 
 // New create a new goscrapy engine
@@ -44,6 +62,7 @@ func New(opts ...Option) *Engine {
 		concurrency: 1,
 		lg:          logger.NewDefaultLogger("info"),
 		pipelines:   make(map[string][]Pipeline),
+		stats:       NewStats(),
 	}
 
 	for _, opt := range opts {
@@ -87,6 +106,14 @@ func UseScheduler(s Scheduler) Option {
 	}
 }
 
+// UseStrategy set a priority scheduler scheduling requests with strategy, e.g. BreadthFirst,
+// DepthFirst or DepthPriority.
+func UseStrategy(strategy Strategy) Option {
+	return func(e *Engine) {
+		e.sched = NewPriorityScheduler(strategy)
+	}
+}
+
 // WithDelay set the duration to wait before handling next request.
 func WithDelay(delay time.Duration) Option {
 	return func(e *Engine) {
@@ -116,7 +143,8 @@ func WithRequestMiddlewares(middlewares ...RequestHandleFunc) Option {
 
 // WithResponseMiddlewares registers response middlewares. Response will be processed by
 // response middlewares right after downloader finishes downloading and takes over
-// response to engine
+// response to engine. Calling Request.Abort of resp.Request in middleware stops the
+// response from being parsed by spiders.
 func WithResponseMiddlewares(middlewares ...ResponseHandleFunc) Option {
 	return func(e *Engine) {
 		e.responseHandlers = append(e.responseHandlers, middlewares...)
@@ -131,6 +159,32 @@ func MaxCrawlingDepth(depth int) Option {
 	}
 }
 
+// KeepAlive returns an Option that keeps engine alive between runs of recurring spiders
+// (see RecurringSpider), engine will keep running until Stop is called or all spiders have
+// been closed. Without it, recurring spiders only run once.
+func KeepAlive() Option {
+	return func(e *Engine) {
+		e.keepAlive = true
+	}
+}
+
+// URLCanonicalizer canonicalizes urls, see CanonicalizeURLs.
+type URLCanonicalizer interface {
+	Canonicalize(rawURL string) (string, error)
+}
+
+// CanonicalizeURLs returns an Option that canonicalizes urls of requests generated by spiders
+// before scheduling, so that urls in different forms referring to the same page (e.g. with
+// tracking params) are crawled only once. Request.Query will be merged into URL, and the
+// original url is kept by Request.OriginalURL. Requests with the same method and canonical url
+// as requests scheduled before by the same spider (in the same run, see RecurringSpider) are
+// dropped, unless Request.DontFilter is set. See package pkg/canonical for implementation.
+func CanonicalizeURLs(c URLCanonicalizer) Option {
+	return func(e *Engine) {
+		e.canonicalizer = c
+	}
+}
+
 // RegisterSipders add working spiders
 func (e *Engine) RegisterSipders(spiders ...Spider) {
 	e.mux.Lock()
@@ -142,13 +196,30 @@ func (e *Engine) RegisterSipders(spiders ...Spider) {
 			continue
 		}
 		e.lg.Infof(context.Background(), "loading spider [%s]", s.Name())
+		if la, ok := s.(LoggerAware); ok {
+			la.SetLogger(e.lg)
+		}
 		e.spiders = append(e.spiders, s)
 	}
 }
 
-// RegisterPipelines register pipelines
+// RegisterPipelines register pipelines. Pipelines handling the same item run one
+// by one in the order of priority (see PriorityPipeline) and registration.
 func (e *Engine) RegisterPipelines(pipelines ...Pipeline) {
 	for _, p := range pipelines {
+		if p == nil {
+			continue
+		}
+		e.pipelineSet = append(e.pipelineSet, p)
+
+		if da, ok := unwrapPipeline(p).(DownloaderAware); ok {
+			da.SetDownloader(e)
+		}
+
+		if la, ok := unwrapPipeline(p).(LoggerAware); ok {
+			la.SetLogger(e.lg)
+		}
+
 		// remove duplicated item name
 		tmp := map[string]struct{}{}
 		for _, item := range p.ItemList() {
@@ -159,53 +230,180 @@ func (e *Engine) RegisterPipelines(pipelines ...Pipeline) {
 			tmp[item] = struct{}{}
 		}
 	}
+
+	for item := range e.pipelines {
+		list := e.pipelines[item]
+		sort.SliceStable(list, func(i, j int) bool {
+			return pipelinePriority(list[i]) < pipelinePriority(list[j])
+		})
+	}
 }
 
-// Start starts engine
+// RegisterItemPipelines register pipelines that receive items in their concrete types.
+func (e *Engine) RegisterItemPipelines(pipelines ...ItemPipeline) {
+	for _, p := range pipelines {
+		if p == nil {
+			continue
+		}
+		e.RegisterPipelines(&itemPipelineAdapter{ItemPipeline: p})
+	}
+}
+
+// Start starts engine, it blocks until all requests have been handled. Errors of opening
+// pipelines are logged only, using Run to get them.
 func (e *Engine) Start() {
+	e.Run()
+}
+
+// Run runs engine as Start does, it returns error if failed to open pipelines.
+func (e *Engine) Run() error {
 	ctx := context.Background()
-	if e.state == stateRunning {
+	e.stopMux.Lock()
+	if !atomic.CompareAndSwapInt32(&e.state, stateStoped, stateRunning) {
+		e.stopMux.Unlock()
 		e.lg.Infof(ctx, "engine already running")
-		return
+		return nil
 	}
-
-	e.state = stateRunning
+	e.stopReason = ""
+	e.stopMux.Unlock()
 
 	e.lg.Infof(ctx, "start engine ...")
+	if err := e.openPipelines(ctx); err != nil {
+		e.lg.Errorf(ctx, "failed to open pipelines: %v", err)
+		atomic.StoreInt32(&e.state, stateStoped)
+		return err
+	}
+
+	// holding requests with NotBefore until they are due
+	if _, ok := e.sched.(*DelayScheduler); !ok {
+		e.sched = NewDelayScheduler(e.sched)
+	}
 	e.sched.Start()
 
 	wg := waitgroup.Wrapper{}
 
-	// load first started requests from all spiders
-	e.loadStartRequests()
+	e.openSpiders(ctx)
+	stopTimers := e.startBudgetTimers(ctx)
 
 	for i := 0; i < e.concurrency; i++ {
 		// start request handler
 		wg.RecoverableWrap(e.requestHandler)
 	}
 
+	// load first started requests from all spiders, requests are loaded in background
+	// so that workers could consume requests while loading.
+	for _, st := range e.openedSpiders() {
+		st := st
+		e.holdSpider(st)
+		go e.startRun(st)
+	}
+
 	wg.Wrap(e.requestProbe) // start request probe
 
 	wg.Wait()
+	stopTimers()
+
+	// all workers have exited, finishing spiders whose requests left in scheduler will
+	// never be handled
+	reason := e.StopReason()
+	for _, st := range e.allSpiderStates() {
+		e.CloseSpider(st.spider.Name(), reason)
+		e.finishSpider(st)
+	}
+
+	return nil
 }
 
-func (e *Engine) loadStartRequests() {
+// openPipelines opens all pipelines implementing PipelineOpener for every spider. Pipelines
+// that have been opened will be closed if any pipeline failed to open.
+func (e *Engine) openPipelines(ctx context.Context) error {
 	e.mux.RLock()
-	defer e.mux.RLock()
+	defer e.mux.RUnlock()
 
-	for index := range e.spiders {
-		spider := e.spiders[index]
-		requests := spider.StartRequests()
-		for index := range requests {
-			e.lg.Infof(context.Background(), "adding started reqeust from %s : %s", spider.Name(), requests[index].URL)
-			req := requests[index]
-			req.currentDepth = 1
-			ok := e.sched.PushRequest(req)
+	type opened struct {
+		pipeline Pipeline
+		spider   Spider
+	}
+
+	var openedList []opened
+	for _, spider := range e.spiders {
+		for _, p := range e.pipelineSet {
+			opener, ok := unwrapPipeline(p).(PipelineOpener)
 			if !ok {
-				return
+				continue
+			}
+
+			if err := opener.Open(ctx, spider); err != nil {
+				for _, o := range openedList {
+					if closer, ok := unwrapPipeline(o.pipeline).(PipelineCloser); ok {
+						closer.Close(ctx, o.spider)
+					}
+				}
+				return fmt.Errorf("pipeline [%s] failed to open for spider [%s]: %v", p.Name(), spider.Name(), err)
 			}
+
+			openedList = append(openedList, opened{pipeline: p, spider: spider})
 		}
 	}
+
+	return nil
+}
+
+// closePipelines closes all pipelines implementing PipelineCloser for spider.
+func (e *Engine) closePipelines(ctx context.Context, spider Spider) {
+	for _, p := range e.pipelineSet {
+		closer, ok := unwrapPipeline(p).(PipelineCloser)
+		if !ok {
+			continue
+		}
+
+		if err := closer.Close(ctx, spider); err != nil {
+			e.lg.Errorf(ctx, "pipeline [%s] failed to close for spider [%s]: %v", p.Name(), spider.Name(), err)
+		}
+	}
+}
+
+// loadStartRequests pushes start requests of spider into scheduler. For spiders
+// implementing StartRequestStreamer, requests are consumed lazily as the scheduler
+// has room.
+func (e *Engine) loadStartRequests(st *spiderState) {
+	ctx := st.ctx
+	defer e.releaseSpider(ctx, st)
+
+	spider := st.spider
+	streamer, ok := spider.(StartRequestStreamer)
+	if !ok {
+		requests := e.prepareRequests(ctx, spider, spider.StartRequests(), 1)
+		for index := range requests {
+			e.lg.Infof(ctx, "adding started reqeust from %s : %s", spider.Name(), requests[index].URL)
+		}
+
+		e.pushRequests(requests)
+		return
+	}
+
+	stream := make(chan *Request)
+	go func() {
+		defer close(stream)
+		if err := streamer.StreamStartRequests(ctx, stream); err != nil {
+			e.lg.Errorf(ctx, "spider [%s] failed to stream start requests: %v", spider.Name(), err)
+		}
+	}()
+
+	var count int
+	for req := range stream {
+		requests := e.prepareRequests(ctx, spider, []*Request{req}, 1)
+		if ok := e.pushRequests(requests); !ok {
+			// scheduler has been stopped, drain the stream until producer quits
+			st.cancel()
+			for range stream {
+			}
+			break
+		}
+		count += len(requests)
+	}
+
+	e.lg.Infof(ctx, "loaded %d started requests from %s", count, spider.Name())
 }
 
 func (e *Engine) requestHandler() {
@@ -215,43 +413,102 @@ func (e *Engine) requestHandler() {
 			return
 		}
 
-		requestID, _ := uuid.GenerateUUID()
-		ctx := logger.AppendMetadata(
-			context.Background(),
-			logger.NewMetadata().Append("request_id", requestID),
-		)
+		e.handle(req)
+	}
+}
 
-		spiders := e.getRelativeSpider(req.URL)
-		if len(spiders) <= 0 {
-			e.lg.Warnf(ctx, "no spider found to handle request: %s", req.URL)
-			continue
-		}
+// handle handles request until the response has been parsed by spiders.
+func (e *Engine) handle(req *Request) {
+	requestID, _ := uuid.GenerateUUID()
+	ctx := logger.AppendMetadata(
+		context.Background(),
+		logger.NewMetadata().Append("request_id", requestID),
+	)
 
-		resp, err := e.handleRequest(ctx, req)
-		if err != nil {
-			e.lg.Errorf(ctx, "<%s %s>  %v", req.Method, req.URL, err)
-			continue
-		}
+	defer e.requestDone(ctx, req)
+	defer e.reschedule(ctx, req) // before releasing request, so that spider won't become idle
 
-		if resp == nil {
-			continue
-		}
+	if e.isStopped() || e.isSpiderClosed(req.spider) {
+		e.lg.Debugf(ctx, "spider [%s] has been closed, drop request: %s", req.spider, req.URL)
+		return
+	}
+
+	if reason := e.budget.exceeded(&e.usage); reason != "" {
+		e.lg.Debugf(ctx, "crawling budget has been exhausted [%s], drop request: %s", reason, req.URL)
+		return
+	}
+
+	spiders := e.getRelativeSpider(req.URL)
+	if len(spiders) <= 0 {
+		e.lg.Warnf(ctx, "no spider found to handle request: %s", req.URL)
+		return
+	}
+
+	resp, err := e.handleRequest(ctx, req)
+	e.recordDownload(ctx, req, resp, err)
+	if err != nil || resp == nil {
+		return
+	}
 
-		e.lg.Infof(ctx, "<%s %s %s>", req.Method, req.URL, resp.Status)
+	e.handleResponse(ctx, spiders, resp)
 
-		e.handleResponse(ctx, spiders, resp)
+	time.Sleep(e.delay)
+}
+
+// reschedule schedules request again if it has been rescheduled by middlewares, see
+// Request.Reschedule.
+func (e *Engine) reschedule(ctx context.Context, req *Request) {
+	if !req.rescheduled {
+		return
+	}
 
-		time.Sleep(e.delay)
+	req.aborted = false
+	req.rescheduled = false
+	if e.isStopped() || e.isSpiderClosed(req.spider) {
+		e.lg.Debugf(ctx, "spider [%s] has been closed, drop rescheduled request: %s", req.spider, req.URL)
+		return
 	}
+
+	e.lg.Infof(ctx, "rescheduling request [%s %s] not before %s", req.Method, req.URL, req.NotBefore.Format(time.RFC3339))
+	e.trackRequest(req)
+	go e.pushRequests([]*Request{req})
+}
+
+// recordDownload logs the result of downloading request, and records it into stats and budget.
+func (e *Engine) recordDownload(ctx context.Context, req *Request, resp *Response, err error) {
+	if err != nil {
+		e.lg.Errorf(ctx, "<%s %s>  %v", req.Method, req.URL, err)
+		e.stats.Inc(StatDownloadError, 1)
+		e.useBudget(ctx, req.spider, func(u *budgetUsage) {
+			atomic.AddInt64(&u.errors, 1)
+		})
+		return
+	}
+
+	if resp == nil {
+		return
+	}
+
+	e.lg.Infof(ctx, "<%s %s %s>", req.Method, req.URL, resp.Status)
+	e.stats.Inc(StatResponseReceived, 1)
+	e.stats.Inc(StatResponseBytes, int64(len(resp.Body)))
+	e.useBudget(ctx, req.spider, func(u *budgetUsage) {
+		atomic.AddInt64(&u.responses, 1)
+		atomic.AddInt64(&u.bytes, int64(len(resp.Body)))
+	})
 }
 
 func (e *Engine) getRelativeSpider(url string) []Spider {
 	e.mux.RLock()
-	defer e.mux.RLocker()
+	defer e.mux.RUnlock()
 
 	var spiders []Spider
 	for index := range e.spiders {
 		spider := e.spiders[index]
+		if st, ok := e.spiderStates[spider.Name()]; ok && st.isClosed() {
+			continue
+		}
+
 		if spider.URLMatcher().Match(url) {
 			spiders = append(spiders, spider)
 		}
@@ -281,39 +538,166 @@ func (e *Engine) getNextRequest() (*Request, bool) {
 	return req, true
 }
 
-func (e *Engine) addRequests(ctx *Context, reqs []*Request) {
+// prepareRequests sets depth and spider of requests, requests exceeding max crawling
+// depth will be dropped. Returned requests are tracked as pending requests of spider.
+func (e *Engine) prepareRequests(ctx context.Context, spider Spider, reqs []*Request, depth int) []*Request {
+	// no more requests will be scheduled once spider has been closed (e.g. budget exhausted)
+	if e.isStopped() || e.isSpiderClosed(spider.Name()) {
+		return nil
+	}
+
+	var res []*Request
 	for index := range reqs {
 		req := reqs[index]
 		if req == nil {
 			continue
 		}
 
-		req.currentDepth = ctx.Request().currentDepth + 1
+		req.currentDepth = depth
+		req.spider = spider.Name()
+		if st := e.getSpiderState(req.spider); st != nil {
+			req.run = int(atomic.LoadInt32(&st.run))
+		}
 		if e.maxCrawlingDepth > 0 && req.currentDepth > e.maxCrawlingDepth {
 			// has exceeds max crawling depth, drop it !!!
 			e.lg.Debugf(ctx, "exceeds max crawling depth [max=%v], drop request: %s", e.maxCrawlingDepth, req.URL)
 			continue
 		}
 
-		e.lg.Infof(ctx, "adding new request [%s %s]", req.Method, req.URL)
-		if ok := e.sched.PushRequest(req); !ok {
+		e.canonicalize(ctx, req)
+		if e.isDuplicate(req) {
+			e.lg.Debugf(ctx, "duplicate request, drop it: %s", req.URL)
+			e.stats.Inc(StatRequestFiltered, 1)
+			continue
+		}
+
+		e.trackRequest(req)
+		res = append(res, req)
+	}
+
+	return res
+}
+
+// canonicalize canonicalizes url of request, request is kept as it is if failed.
+func (e *Engine) canonicalize(ctx context.Context, req *Request) {
+	if e.canonicalizer == nil || req.originalURL != "" {
+		return
+	}
+
+	rawURL := req.URL
+	if len(req.Query) > 0 {
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			e.lg.Warnf(ctx, "failed to canonicalize url %s: %v", req.URL, err)
 			return
 		}
+		u.RawQuery = req.Query.Encode()
+		rawURL = u.String()
+	}
+
+	canonical, err := e.canonicalizer.Canonicalize(rawURL)
+	if err != nil {
+		e.lg.Warnf(ctx, "failed to canonicalize url %s: %v", rawURL, err)
+		return
+	}
+
+	req.originalURL = rawURL
+	req.URL = canonical
+	req.Query = nil
+}
+
+// isDuplicate returns true if the same request (i.e. the same method and canonical url) has
+// been scheduled by spider before, requests are only filtered along with CanonicalizeURLs.
+func (e *Engine) isDuplicate(req *Request) bool {
+	if e.canonicalizer == nil || req.DontFilter {
+		return false
+	}
+
+	st := e.getSpiderState(req.spider)
+	if st == nil {
+		return false
+	}
+
+	fp := requestFingerprint(req)
+
+	st.seenMux.Lock()
+	defer st.seenMux.Unlock()
+
+	if st.seen == nil {
+		st.seen = make(map[[sha1.Size]byte]struct{})
+	}
+
+	if _, ok := st.seen[fp]; ok {
+		return true
+	}
+
+	st.seen[fp] = struct{}{}
+	return false
+}
+
+// requestFingerprint returns the fingerprint identifying request.
+func requestFingerprint(req *Request) [sha1.Size]byte {
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
 	}
+
+	// query is not merged into url if failed to canonicalize
+	return sha1.Sum([]byte(method + " " + req.URL + "\x00" + req.Query.Encode()))
+}
+
+// pushRequests pushes requests into scheduler, it returns false if scheduler
+// has been stopped.
+func (e *Engine) pushRequests(reqs []*Request) bool {
+	for index, req := range reqs {
+		if ok := e.sched.PushRequest(req); !ok {
+			// requests will never be handled
+			for _, r := range reqs[index:] {
+				if st := e.getSpiderState(r.spider); st != nil {
+					atomic.AddInt64(&st.pending, -1)
+				}
+			}
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *Engine) addRequests(ctx *Context, spider Spider, reqs []*Request) {
+	reqs = e.prepareRequests(ctx, spider, reqs, ctx.Request().currentDepth+1)
+	for _, req := range reqs {
+		e.lg.Infof(ctx, "adding new request [%s %s]", req.Method, req.URL)
+	}
+
+	// pushing synchronously if possible, so that new requests are scheduled before the
+	// worker pops the next request.
+	if nb, ok := e.sched.(NonBlockingScheduler); ok && nb.NonBlocking() {
+		e.pushRequests(reqs)
+		return
+	}
+
+	// TODO:
+	// FIX IT: create a new goroutine everytime here, may cause too many blocked goroutine
+	go e.pushRequests(reqs)
 }
 
 // requestProbe starts a loop to detect whether there is more unhandled request
 // in scheduler. Engine will stop if no more requests available.
 func (e *Engine) requestProbe() {
 	for {
+		if e.isStopped() {
+			return
+		}
+
 		// if there is no more request in scheduler and the amount of
 		// pending workers equals to concurrency, it means all crawling requests
 		// has been handled and, probably, there are no more coming requests in the future.
-		if !e.sched.HasMore() && (e.pendingCnt == int32(e.concurrency)) {
+		if e.isIdle() {
 			// waiting for a while to make sure no more requests
 			time.Sleep(time.Millisecond * 500)
-			if !e.sched.HasMore() && (e.pendingCnt == int32(e.concurrency)) {
-				e.Stop()
+			if e.isIdle() && !e.idleSpiders() {
+				e.stop(CloseReasonFinished)
 				return
 			}
 		}
@@ -321,6 +705,22 @@ func (e *Engine) requestProbe() {
 	}
 }
 
+func (e *Engine) isIdle() bool {
+	return !e.sched.HasMore() && atomic.LoadInt32(&e.pendingCnt) == int32(e.concurrency) && !e.hasPendingRequests()
+}
+
+// idleSpiders notifies all running spiders that engine is idle, it returns true
+// if any spider generates more requests.
+func (e *Engine) idleSpiders() bool {
+	var more bool
+	for _, st := range e.openedSpiders() {
+		if e.spiderIdle(context.Background(), st) {
+			more = true
+		}
+	}
+	return more
+}
+
 func (e *Engine) handleRequest(ctx context.Context, req *Request) (*Response, error) {
 	// handle request using middlewares before passing to downloader
 	for _, fn := range e.requestHandlers {
@@ -347,6 +747,11 @@ func (e *Engine) handleResponse(ctx context.Context, spiders []Spider, resp *Res
 		}
 	}
 
+	if resp.Request != nil && resp.Request.IsAborted() {
+		e.lg.Debugf(ctx, "request has been aborted, skip parsing response: %s", resp.Request.URL)
+		return
+	}
+
 	wg := waitgroup.Wrapper{}
 	for index := range spiders {
 		spider := spiders[index]
@@ -356,59 +761,216 @@ func (e *Engine) handleResponse(ctx context.Context, spiders []Spider, resp *Res
 				response: resp,
 			}
 
-			items, newReqs, err := spider.Parse(sctx)
+			items, newReqs, err := e.parse(sctx, spider)
 			if err != nil {
 				e.lg.Errorf(ctx, "spider [%s] failed to parse result, %v", spider.Name(), err)
+				e.stats.Inc(StatSpiderError, 1)
+				e.useBudget(ctx, spider.Name(), func(u *budgetUsage) {
+					atomic.AddInt64(&u.errors, 1)
+				})
 				return
 			}
 
 			// passing items to all associated pipelines
-			e.handleItems(sctx, items)
+			for _, item := range items {
+				if scraped := e.handleItems(sctx, spider.Name(), item); scraped {
+					e.useBudget(ctx, spider.Name(), func(u *budgetUsage) {
+						atomic.AddInt64(&u.items, 1)
+					})
+				}
+			}
 
-			// TODO:
-			// 1 - calculate request depth
-			// 2 - FIX IT: create a new goroutine everytime here, may cause too many blocked goroutine
-			go e.addRequests(sctx, newReqs)
+			e.addRequests(sctx, spider, newReqs)
 		})
 	}
 	wg.Wait()
 }
 
-func (e *Engine) handleItems(ctx context.Context, items *Items) {
-	if items == nil || items.Name() == "" {
-		return
+// parse parses response using spider, items returned by spider will be
+// converted into []Item.
+func (e *Engine) parse(ctx *Context, spider Spider) ([]Item, []*Request, error) {
+	if parser, ok := spider.(ItemParser); ok {
+		items, reqs, err := parser.ParseItems(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var res []Item
+		for _, item := range items {
+			if items, ok := item.(*Items); ok {
+				if items == nil {
+					continue
+				}
+				items.spider = spider.Name()
+			}
+			res = append(res, item)
+		}
+
+		return res, reqs, nil
+	}
+
+	items, reqs, err := spider.Parse(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if items == nil {
+		return nil, reqs, nil
 	}
 
-	pipelines, ok := e.pipelines[items.Name()]
+	items.spider = spider.Name()
+	return []Item{items}, reqs, nil
+}
+
+// handleItems passes item generated by spider through all associated pipelines in order,
+// pipelines could stop the chain by returning ErrDropItem. It returns true if item has been
+// scraped (i.e. not dropped).
+func (e *Engine) handleItems(ctx context.Context, spider string, item Item) bool {
+	if item == nil || item.ItemName() == "" {
+		return false
+	}
+
+	pipelines, ok := e.pipelines[item.ItemName()]
 	if !ok {
-		e.lg.Warnf(ctx, "no pipeline associate with items: %s", items.Name())
-		return
+		e.lg.Warnf(ctx, "no pipeline associate with items: %s", item.ItemName())
+		return false
 	}
 
-	var wg waitgroup.Wrapper
 	for _, p := range pipelines {
 		if p == nil {
 			continue
 		}
 
-		wg.Wrap(func() {
-			err := p.Handle(items)
-			if err != nil {
-				e.lg.Errorf(ctx, "pipeline [%s] error: %s", p.Name(), err)
-			}
-		})
+		next, err := e.processItem(p, spider, item)
+		if errors.Is(err, ErrDropItem) || (err == nil && next == nil) {
+			e.lg.Debugf(ctx, "pipeline [%s] dropped item %s: %v", p.Name(), item.ItemName(), err)
+			e.stats.Inc(StatItemDropped, 1)
+			return false
+		}
+
+		if err != nil {
+			e.lg.Errorf(ctx, "pipeline [%s] error: %s", p.Name(), err)
+			e.stats.Inc(StatPipelineError, 1)
+			continue
+		}
+
+		item = next
 	}
 
-	wg.Wait()
+	e.stats.Inc(StatItemScraped, 1)
+	return true
+}
+
+// processItem handles item generated by spider using pipeline, it returns the item for
+// next pipeline.
+func (e *Engine) processItem(p Pipeline, spider string, item Item) (next Item, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recover from pipeline panic: %v", r)
+			next = item
+		}
+	}()
+
+	switch pp := unwrapPipeline(p).(type) {
+	case TransformPipeline:
+		return pp.Process(item)
+	case ItemPipeline:
+		return item, pp.HandleItem(item)
+	default:
+		items := ToItems(item)
+		if items == item {
+			return item, p.Handle(items)
+		}
+
+		// typed items are handled as a copy, writing modifications back into item
+		items.spider = spider
+		before := ItemToMap(items)
+		if err := p.Handle(items); err != nil {
+			return item, err
+		}
+
+		return writeBackItems(item, before, items)
+	}
 }
 
-// Stop stops engine
+// Download downloads request through engine, the request will be processed by request
+// middlewares, downloader and response middlewares as requests generated by spiders, and
+// engine waits for the configured delay after downloading. Downloads are recorded into
+// stats and counted against the budget of all spiders (see WithBudget), ErrBudgetExhausted
+// is returned once the budget has been exhausted. Unlike requests generated by spiders,
+// requests bypass the scheduler (so scheduler delays, e.g. of HostScheduler, don't apply)
+// and responses will not be passed to spiders. It's aimed to be used by pipelines
+// downloading resources referenced by items, see DownloaderAware.
+func (e *Engine) Download(req *Request) (*Response, error) {
+	ctx := context.Background()
+	if reason := e.budget.exceeded(&e.usage); reason != "" {
+		return nil, fmt.Errorf("%w: %s", ErrBudgetExhausted, reason)
+	}
+
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+
+	resp, err := e.handleRequest(ctx, req)
+	e.recordDownload(ctx, req, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	defer time.Sleep(e.delay)
+
+	if resp == nil {
+		return nil, ErrRequestAborted
+	}
+
+	for _, fn := range e.responseHandlers {
+		if err := fn(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// Stats returns crawling stats
+func (e *Engine) Stats() *Stats {
+	return e.stats
+}
+
+// Stop stops engine, all running spiders will be closed with reason CloseReasonShutdown.
 func (e *Engine) Stop() {
-	if e.state == stateStoped {
-		return
+	e.stop(CloseReasonShutdown)
+}
+
+// StopReason returns the reason why engine has been stopped, e.g. CloseReasonFinished
+// or CloseReasonMaxResponses if crawling budget has been exhausted.
+func (e *Engine) StopReason() string {
+	e.stopMux.Lock()
+	defer e.stopMux.Unlock()
+
+	return e.stopReason
+}
+
+// stop stops engine with reason, all running spiders will be closed with the same reason.
+// It returns false if engine has been stopped already.
+func (e *Engine) stop(reason string) bool {
+	e.stopMux.Lock()
+	if !atomic.CompareAndSwapInt32(&e.state, stateRunning, stateStoped) {
+		e.stopMux.Unlock()
+		return false
 	}
+	e.stopReason = reason
+	e.stopMux.Unlock()
 
-	e.state = stateStoped
 	e.lg.Infof(context.Background(), "stop engine...")
 	e.sched.Stop()
+
+	for _, st := range e.openedSpiders() {
+		e.CloseSpider(st.spider.Name(), reason)
+	}
+
+	return true
+}
+
+func (e *Engine) isStopped() bool {
+	return atomic.LoadInt32(&e.state) == stateStoped
 }
@@ -3,10 +3,15 @@ module github.com/jiandahao/goscrapy
 go 1.14
 
 require (
+	github.com/PaesslerAG/jsonpath v0.1.1
 	github.com/PuerkitoBio/goquery v1.6.1
+	github.com/antchfx/htmlquery v1.2.3
 	github.com/hashicorp/go-uuid v1.0.1
 	github.com/jiandahao/goutils v0.1.2-0.20221006144758-62c38dc7f2ef
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/tebeka/selenium v0.9.9
 	github.com/urfave/cli v1.22.5
 	go.uber.org/zap v1.16.0
+	golang.org/x/image v0.0.0-20201208152932-35266b937fa6
+	golang.org/x/net v0.0.0-20200625001655-4c5254603344
 )
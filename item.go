@@ -0,0 +1,257 @@
+package goscrapy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Item represents structured data scraped by spiders. Besides *Items, any go struct
+// implementing Item could be returned by spiders implementing ItemParser, goscrapy
+// pipeline will make the decision whether to handle an item based on ItemName.
+/* for example:
+type Product struct {
+	Title string  `json:"title"`
+	Price float64 `json:"price"`
+}
+
+func (p *Product) ItemName() string {
+	return "product"
+}
+*/
+type Item interface {
+	ItemName() string
+}
+
+// ItemParser is an optional interface implemented by spiders that return typed items.
+// The engine calls ParseItems instead of Spider.Parse if a spider implements it.
+type ItemParser interface {
+	ParseItems(ctx *Context) ([]Item, []*Request, error)
+}
+
+// ItemPipeline is a pipeline that receives items in their concrete types. Pipelines
+// implementing both Pipeline and ItemPipeline will be handled with HandleItem. Using
+// Engine.RegisterItemPipelines to register pipelines only implementing ItemPipeline.
+type ItemPipeline interface {
+	Name() string       // returns pipeline's name
+	ItemList() []string // returns all items' name that this pipeline cares about
+	HandleItem(item Item) error
+}
+
+// itemPipelineAdapter adapts ItemPipeline to Pipeline.
+type itemPipelineAdapter struct {
+	ItemPipeline
+}
+
+// Handle handles items by passing it to HandleItem.
+func (a *itemPipelineAdapter) Handle(items *Items) error {
+	return a.HandleItem(items)
+}
+
+// unwrapPipeline returns the pipeline registered by user.
+func unwrapPipeline(p Pipeline) interface{} {
+	if a, ok := p.(*itemPipelineAdapter); ok {
+		return a.ItemPipeline
+	}
+	return p
+}
+
+// pipelinePriority returns the priority of pipeline.
+func pipelinePriority(p Pipeline) int {
+	if pp, ok := unwrapPipeline(p).(PriorityPipeline); ok {
+		return pp.Priority()
+	}
+	return 0
+}
+
+// ToItems converts item into *Items, it's the adapter that allows typed items to
+// flow through pipelines that only accept *Items. Struct fields are stored with the
+// key of their json tag name (or field name if no json tag). When typed items are
+// handled by such pipelines, engine records the spider generating the item (see
+// Items.SpiderName), and modifications made by pipelines are written back into the
+// typed items.
+func ToItems(item Item) *Items {
+	if items, ok := item.(*Items); ok {
+		return items
+	}
+
+	items := NewItems(item.ItemName())
+	for key, val := range ItemToMap(item) {
+		items.Store(key, val)
+	}
+
+	return items
+}
+
+// writeBackItems writes fields of items modified by pipelines (i.e. different from before)
+// back into the typed item that items is converted from, it's the reverse of ToItems. Fields
+// are matched by json tag names and decoded as JSON, keys that are deleted or not mapped to
+// any field are ignored. Struct pointers are modified in place, while a modified copy is
+// returned for struct values. Items of other kinds are returned as it is.
+func writeBackItems(item Item, before map[string]interface{}, items *Items) (Item, error) {
+	changed := make(map[string]interface{})
+	for key, val := range ItemToMap(items) {
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, val) {
+			changed[key] = val
+		}
+	}
+
+	if len(changed) == 0 {
+		return item, nil
+	}
+
+	v := reflect.ValueOf(item)
+	isPtr := v.Kind() == reflect.Ptr
+	if isPtr {
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return item, nil
+		}
+	} else if v.Kind() != reflect.Struct {
+		return item, nil
+	} else {
+		// copying struct value into an addressable one
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+
+	data, err := json.Marshal(changed)
+	if err != nil {
+		return item, err
+	}
+
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return item, fmt.Errorf("failed to write items back into %T: %v", item, err)
+	}
+
+	if isPtr {
+		return item, nil
+	}
+
+	next, ok := v.Elem().Interface().(Item)
+	if !ok {
+		return item, nil
+	}
+
+	return next, nil
+}
+
+// ItemToMap converts item into map. For struct items, keys are json tag names of
+// fields (or field names if no json tag), fields tagged with `json:"-"` and
+// unexported fields are skipped.
+func ItemToMap(item Item) map[string]interface{} {
+	res := make(map[string]interface{})
+	if items, ok := item.(*Items); ok {
+		items.Range(func(key, value interface{}) bool {
+			res[fmt.Sprint(key)] = value
+			return true
+		})
+		return res
+	}
+
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return res
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		structToMap(v, res)
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			res[fmt.Sprint(key.Interface())] = v.MapIndex(key).Interface()
+		}
+	}
+
+	return res
+}
+
+func structToMap(v reflect.Value, res map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+
+		name, omitEmpty := parseJSONTag(field)
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+
+			if fv.Kind() == reflect.Struct {
+				structToMap(fv, res)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		res[name] = fv.Interface()
+	}
+}
+
+func parseJSONTag(field reflect.StructField) (name string, omitEmpty bool) {
+	tag, ok := field.Tag.Lookup("json")
+	if !ok {
+		return "", false
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+
+	return parts[0], omitEmpty
+}
+
+// ErrDropItem is the error returned by pipelines to stop an item from being passed
+// to the following pipelines, using DropItem to create it with reason.
+var ErrDropItem = errors.New("drop item")
+
+// DropItem returns an error that drops the item with reason.
+func DropItem(reason string) error {
+	return fmt.Errorf("%w: %s", ErrDropItem, reason)
+}
+
+// PriorityPipeline is an optional interface implemented by pipelines to decide the
+// order of pipelines handling the same item. Pipelines with lower priority run first,
+// pipelines not implementing it have the priority of 0. Pipelines with the same
+// priority run in the order of registration.
+type PriorityPipeline interface {
+	Priority() int
+}
+
+// TransformPipeline is an optional interface implemented by pipelines that modify or
+// replace items. Pipelines implementing it will be handled with Process instead of
+// Handle or HandleItem, the returned item will be passed to the next pipeline. Returning
+// a nil item is equal to dropping the item.
+type TransformPipeline interface {
+	Process(item Item) (Item, error)
+}
@@ -1,6 +1,11 @@
 package goscrapy
 
-import "regexp"
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
 
 // URLMatcher url matcher
 type URLMatcher interface {
@@ -41,3 +46,33 @@ func NewStaticStringMatcher(str string) *StringMatcher {
 func (m *StringMatcher) Match(url string) bool {
 	return m.str == url
 }
+
+// HostMatcher matches urls by host, hosts could be added at any time.
+type HostMatcher struct {
+	hosts sync.Map // map[string]struct{}
+}
+
+// NewHostMatcher new host matcher
+func NewHostMatcher(hosts ...string) *HostMatcher {
+	m := &HostMatcher{}
+	for _, host := range hosts {
+		m.Add(host)
+	}
+	return m
+}
+
+// Add adds host into matcher
+func (m *HostMatcher) Add(host string) {
+	m.hosts.Store(strings.ToLower(host), struct{}{})
+}
+
+// Match returns true if host of url is matched
+func (m *HostMatcher) Match(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	_, ok := m.hosts.Load(strings.ToLower(u.Host))
+	return ok
+}
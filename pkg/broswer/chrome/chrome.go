@@ -1,12 +1,17 @@
 package chrome
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"sync"
 	"sync/atomic"
 
 	"github.com/tebeka/selenium"
 	"github.com/tebeka/selenium/chrome"
+	"github.com/tebeka/selenium/log"
 )
 
 const (
@@ -31,6 +36,10 @@ type Config struct {
 	UserAgent         string
 	DownloadDirectory string // default download directory
 	ProxyURL          string // proxy url
+	UserDataDir       string // user profile directory, using a temporary profile if empty
+	// PerformanceLog enables chrome performance logging, which is required
+	// to capture network activities (e.g. status code, response headers).
+	PerformanceLog bool
 }
 
 // NewBroswer new a chrome broswer
@@ -81,6 +90,10 @@ func (b *Broswer) Open() error {
 		chrCaps.Args = append(chrCaps.Args, fmt.Sprintf("--user-agent=%s", cfg.UserAgent))
 	}
 
+	if cfg.UserDataDir != "" {
+		chrCaps.Args = append(chrCaps.Args, fmt.Sprintf("--user-data-dir=%s", cfg.UserDataDir))
+	}
+
 	if cfg.ProxyURL != "" {
 		chrCaps.Args = append(chrCaps.Args, fmt.Sprintf("--proxy-server=%s", cfg.ProxyURL))
 	}
@@ -103,11 +116,27 @@ func (b *Broswer) Open() error {
 		chrCaps.Prefs["download.default_directory"] = cfg.DownloadDirectory // setting default download directory
 	}
 
+	if cfg.PerformanceLog {
+		enableNetwork := true
+		enablePage := false
+		chrCaps.PerfLoggingPrefs = &chrome.PerfLoggingPreferences{
+			EnableNetwork: &enableNetwork,
+			EnablePage:    &enablePage,
+		}
+		caps.AddLogging(log.Capabilities{
+			log.Performance: log.All,
+		})
+	}
+
 	caps.AddChrome(chrCaps)
 
 	fmt.Println("Creating new remote client to selenium server: ", fmt.Sprintf("http://127.0.0.1:%v/wd/hub", cfg.Port))
 	b.WebDriver, err = selenium.NewRemote(caps, fmt.Sprintf("http://127.0.0.1:%v/wd/hub", cfg.Port))
 	if err != nil {
+		// stopping the service, otherwise chromedriver keeps running and holding the port
+		b.service.Stop()
+		b.service = nil
+		b.WebDriver = nil
 		return err
 	}
 
@@ -141,7 +170,70 @@ func (b *Broswer) Close() error {
 	return err
 }
 
+// Config returns the config of broswer.
+func (b *Broswer) Config() Config {
+	return b.cfg
+}
+
 // DownloadDefaultDirectory returns default download directory
 func (b *Broswer) DownloadDefaultDirectory() string {
 	return b.cfg.DownloadDirectory
 }
+
+// FullPageScreenshot takes a screenshot of the whole page in PNG format by resizing
+// broswer window to the size of page temporarily.
+func (b *Broswer) FullPageScreenshot() ([]byte, error) {
+	res, err := b.ExecuteScript(`return [window.outerWidth, window.outerHeight,
+		document.documentElement.scrollWidth, document.documentElement.scrollHeight];`, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	size, ok := res.([]interface{})
+	if !ok || len(size) != 4 {
+		return nil, fmt.Errorf("unexpected page size: %v", res)
+	}
+
+	dims := make([]int, len(size))
+	for i, v := range size {
+		f, _ := v.(float64)
+		dims[i] = int(f)
+	}
+
+	handle, err := b.CurrentWindowHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.ResizeWindow(handle, dims[2], dims[3]); err != nil {
+		return nil, err
+	}
+	defer b.ResizeWindow(handle, dims[0], dims[1])
+
+	return b.Screenshot()
+}
+
+// PrintToPDF prints current page into PDF, it only works in headless mode.
+func (b *Broswer) PrintToPDF() ([]byte, error) {
+	url := fmt.Sprintf("http://127.0.0.1:%v/wd/hub/session/%s/print", b.cfg.Port, b.SessionID())
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(`{"background":true}`))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, err
+	}
+
+	var data string
+	if err := json.Unmarshal(reply.Value, &data); err != nil {
+		// error reply, see https://www.w3.org/TR/webdriver/#errors
+		return nil, fmt.Errorf("failed to print page: %s", reply.Value)
+	}
+
+	return base64.StdEncoding.DecodeString(data)
+}
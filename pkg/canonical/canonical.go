@@ -0,0 +1,312 @@
+// Package canonical canonicalizes urls, so that urls referring to the same page in
+// different forms (e.g. with tracking params, fragments or different percent-encodings)
+// are crawled only once.
+package canonical
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/jiandahao/goscrapy"
+	"golang.org/x/net/idna"
+)
+
+// DefaultStripParams are query params used for tracking, which are removed by default.
+var DefaultStripParams = []string{
+	"utm_*", "gclid", "dclid", "fbclid", "msclkid", "yclid", "mc_cid", "mc_eid",
+	"_ga", "_gl", "_hsenc", "_hsmi", "igshid", "ref_src", "spm",
+}
+
+// Config canonicalizer config
+type Config struct {
+	// StripParams are names of query params to be removed, names ending with "*" match
+	// params by prefix. DefaultStripParams by default, using an empty non-nil slice to
+	// keep all params.
+	StripParams []string
+	// KeepFragment keeps fragment of url, which is removed by default.
+	KeepFragment bool
+	// KeepQueryOrder keeps the order of query params, which are sorted by default.
+	KeepQueryOrder bool
+}
+
+var _ goscrapy.URLCanonicalizer = &Canonicalizer{}
+
+// Canonicalizer canonicalizes urls by:
+//  1. lowercasing scheme and host, converting internationalized host into punycode (IDNA),
+//     and removing default ports.
+//  2. removing dot segments of path, decoding percent-encoded unreserved characters,
+//     uppercasing percent-encodings and encoding characters that should be escaped.
+//  3. removing tracking params and sorting query params.
+//  4. removing fragment.
+/* for example:
+engine := goscrapy.New(goscrapy.CanonicalizeURLs(canonical.New(canonical.Config{
+	StripParams: append([]string{"sessionid"}, canonical.DefaultStripParams...),
+})))
+*/
+type Canonicalizer struct {
+	cfg Config
+}
+
+// New creates a canonicalizer.
+func New(cfg Config) *Canonicalizer {
+	if cfg.StripParams == nil {
+		cfg.StripParams = DefaultStripParams
+	}
+
+	return &Canonicalizer{cfg: cfg}
+}
+
+var defaultCanonicalizer = New(Config{})
+
+// Canonicalize canonicalizes url with the default config.
+func Canonicalize(rawURL string) (string, error) {
+	return defaultCanonicalizer.Canonicalize(rawURL)
+}
+
+// Canonicalize returns the canonical form of url, only absolute urls are supported.
+func (c *Canonicalizer) Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+
+	if u.Opaque != "" {
+		// e.g. mailto:someone@example.com
+		return rawURL, nil
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("not an absolute url: %s", rawURL)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host, err := normalizeHost(scheme, u.Hostname(), u.Port())
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+	b.WriteString(host)
+	b.WriteString(normalizePath(u.EscapedPath()))
+
+	if query := c.normalizeQuery(u.RawQuery); query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+
+	if index := strings.IndexByte(rawURL, '#'); c.cfg.KeepFragment && index >= 0 && index < len(rawURL)-1 {
+		b.WriteByte('#')
+		b.WriteString(normalizeEscapes(strings.TrimSpace(rawURL[index+1:]), isFragmentChar))
+	}
+
+	return b.String(), nil
+}
+
+func normalizeHost(scheme, hostname, port string) (string, error) {
+	host := strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if strings.Contains(host, ":") {
+		// ipv6
+		host = "[" + host + "]"
+	} else {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("invalid host %s: %v", hostname, err)
+		}
+		host = ascii
+	}
+
+	if port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+
+	return host, nil
+}
+
+func normalizePath(escaped string) string {
+	if escaped == "" {
+		return "/"
+	}
+
+	return removeDotSegments(normalizeEscapes(escaped, isPathChar))
+}
+
+// removeDotSegments removes "." and ".." segments of path, see RFC 3986 section 5.2.4.
+func removeDotSegments(p string) string {
+	segments := strings.Split(p, "/")
+	res := make([]string, 0, len(segments))
+	for index, segment := range segments {
+		last := index == len(segments)-1
+		switch segment {
+		case ".":
+		case "..":
+			if len(res) > 1 {
+				res = res[:len(res)-1]
+			}
+		default:
+			res = append(res, segment)
+			continue
+		}
+
+		// keeping the trailing slash, e.g. /a/b/.. => /a/
+		if last {
+			res = append(res, "")
+		}
+	}
+
+	return strings.Join(res, "/")
+}
+
+type queryParam struct {
+	key   string
+	value string
+	raw   string // normalized key=value
+}
+
+func (c *Canonicalizer) normalizeQuery(rawQuery string) string {
+	var params []queryParam
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+
+		key, value := pair, ""
+		hasValue := false
+		if index := strings.Index(pair, "="); index >= 0 {
+			key, value, hasValue = pair[:index], pair[index+1:], true
+		}
+
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+
+		if c.shouldStrip(name) {
+			continue
+		}
+
+		param := queryParam{
+			key:   normalizeEscapes(key, isQueryChar),
+			value: normalizeEscapes(value, isQueryChar),
+		}
+
+		param.raw = param.key
+		if hasValue {
+			param.raw += "=" + param.value
+		}
+
+		params = append(params, param)
+	}
+
+	if !c.cfg.KeepQueryOrder {
+		sort.SliceStable(params, func(i, j int) bool {
+			if params[i].key != params[j].key {
+				return params[i].key < params[j].key
+			}
+			return params[i].value < params[j].value
+		})
+	}
+
+	res := make([]string, len(params))
+	for index, param := range params {
+		res[index] = param.raw
+	}
+
+	return strings.Join(res, "&")
+}
+
+func (c *Canonicalizer) shouldStrip(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range c.cfg.StripParams {
+		param = strings.ToLower(param)
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(param, "*")) {
+				return true
+			}
+			continue
+		}
+
+		if name == param {
+			return true
+		}
+	}
+
+	return false
+}
+
+const upperhex = "0123456789ABCDEF"
+
+// normalizeEscapes decodes percent-encoded unreserved characters, uppercases other
+// percent-encodings, and encodes characters that are not allowed literally.
+func normalizeEscapes(s string, allowed func(c byte) bool) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(upperhex[decoded>>4])
+				b.WriteByte(upperhex[decoded&15])
+			}
+			i += 2
+			continue
+		}
+
+		if c != '%' && (isUnreserved(c) || allowed(c)) {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(upperhex[c>>4])
+		b.WriteByte(upperhex[c&15])
+	}
+
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isPathChar(c byte) bool {
+	return strings.IndexByte("!$&'()*+,;=:@/", c) >= 0
+}
+
+// isQueryChar returns true if c is allowed in query keys and values, delimiters of
+// params (& and =) are kept encoded, and + is kept as it may represent space.
+func isQueryChar(c byte) bool {
+	return strings.IndexByte("!$'()*+,;:@/?", c) >= 0
+}
+
+func isFragmentChar(c byte) bool {
+	return strings.IndexByte("!$&'()*+,;=:@/?", c) >= 0
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
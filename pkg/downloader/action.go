@@ -0,0 +1,127 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jiandahao/goscrapy"
+	"github.com/tebeka/selenium"
+)
+
+const (
+	defaultActionTimeout  = 10 * time.Second
+	defaultScrollInterval = time.Second
+	defaultNetworkIdle    = 500 * time.Millisecond
+	actionPollInterval    = 100 * time.Millisecond
+)
+
+// performActions performs browser actions in order, results of scripts will be
+// stored into results. Performance logs read while performing are kept by tracker.
+func performActions(wd selenium.WebDriver, actions []goscrapy.BrowserAction, results map[string]interface{}, tracker *networkTracker) error {
+	for index, action := range actions {
+		if err := performAction(wd, action, results, tracker); err != nil {
+			return fmt.Errorf("browser action [%d %s] failed: %v", index, action.Type, err)
+		}
+	}
+
+	return nil
+}
+
+func performAction(wd selenium.WebDriver, action goscrapy.BrowserAction, results map[string]interface{}, tracker *networkTracker) error {
+	timeout := action.Timeout
+	if timeout <= 0 {
+		timeout = defaultActionTimeout
+	}
+
+	switch action.Type {
+	case goscrapy.ActionWaitSelector:
+		by, value := selectorBy(action.Selector)
+		return wd.WaitWithTimeoutAndInterval(func(wd selenium.WebDriver) (bool, error) {
+			elems, err := wd.FindElements(by, value)
+			if err != nil {
+				// element not found yet
+				return false, nil
+			}
+			return len(elems) > 0, nil
+		}, timeout, actionPollInterval)
+	case goscrapy.ActionWaitNetworkIdle:
+		return waitNetworkIdle(wd, tracker, action.Interval, timeout)
+	case goscrapy.ActionClick:
+		elem, err := wd.FindElement(selectorBy(action.Selector))
+		if err != nil {
+			return err
+		}
+		return elem.Click()
+	case goscrapy.ActionType:
+		elem, err := wd.FindElement(selectorBy(action.Selector))
+		if err != nil {
+			return err
+		}
+		return elem.SendKeys(action.Text)
+	case goscrapy.ActionScrollToBottom:
+		return scrollToBottom(wd, action.Times, action.Interval)
+	case goscrapy.ActionExecuteScript:
+		res, err := wd.ExecuteScript(action.Script, action.Args)
+		if err != nil {
+			return err
+		}
+		if action.Name != "" {
+			results[action.Name] = res
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action type")
+	}
+}
+
+// selectorBy returns the locating strategy of selector, selector starting
+// with "/" or "(" will be treated as XPath, otherwise CSS selector.
+func selectorBy(selector string) (string, string) {
+	if strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "(") {
+		return selenium.ByXPATH, selector
+	}
+
+	return selenium.ByCSSSelector, selector
+}
+
+func scrollToBottom(wd selenium.WebDriver, times int, interval time.Duration) error {
+	if times <= 0 {
+		times = 1
+	}
+
+	if interval <= 0 {
+		interval = defaultScrollInterval
+	}
+
+	for i := 0; i < times; i++ {
+		if _, err := wd.ExecuteScript("window.scrollTo(0, document.body.scrollHeight);", nil); err != nil {
+			return err
+		}
+		time.Sleep(interval)
+	}
+
+	return nil
+}
+
+// waitNetworkIdle waits until there has been no request loading for the duration of idle,
+// requests are tracked from chrome performance logs.
+func waitNetworkIdle(wd selenium.WebDriver, tracker *networkTracker, idle, timeout time.Duration) error {
+	if idle <= 0 {
+		idle = defaultNetworkIdle
+	}
+
+	lastBusy := time.Now()
+	return wd.WaitWithTimeoutAndInterval(func(wd selenium.WebDriver) (bool, error) {
+		if err := tracker.collect(wd); err != nil {
+			return false, err
+		}
+
+		if tracker.Inflight() > 0 {
+			lastBusy = time.Now()
+			return false, nil
+		}
+
+		return time.Since(lastBusy) >= idle, nil
+	}, timeout, actionPollInterval)
+}
@@ -0,0 +1,66 @@
+package downloader
+
+import (
+	"github.com/jiandahao/goscrapy"
+)
+
+// capture captures screenshots and PDF of current page as specified by opts.
+func capture(sess *BroswerSession, opts *goscrapy.CaptureOptions) ([]*goscrapy.Artifact, error) {
+	if opts == nil {
+		return nil, nil
+	}
+
+	var artifacts []*goscrapy.Artifact
+	if opts.Screenshot {
+		var data []byte
+		var err error
+		if opts.FullPage {
+			data, err = sess.FullPageScreenshot()
+		} else {
+			data, err = sess.Screenshot()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		artifacts = append(artifacts, &goscrapy.Artifact{
+			Name:        "screenshot.png",
+			ContentType: "image/png",
+			Data:        data,
+		})
+	}
+
+	if opts.Selector != "" {
+		elem, err := sess.FindElement(selectorBy(opts.Selector))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := elem.Screenshot(true)
+		if err != nil {
+			return nil, err
+		}
+
+		artifacts = append(artifacts, &goscrapy.Artifact{
+			Name:        "element.png",
+			ContentType: "image/png",
+			Data:        data,
+		})
+	}
+
+	if opts.PDF {
+		data, err := sess.PrintToPDF()
+		if err != nil {
+			return nil, err
+		}
+
+		artifacts = append(artifacts, &goscrapy.Artifact{
+			Name:        "page.pdf",
+			ContentType: "application/pdf",
+			Data:        data,
+		})
+	}
+
+	return artifacts, nil
+}
@@ -5,12 +5,13 @@ import (
 	"fmt"
 
 	"net/http"
-	"sync"
+	"net/url"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/jiandahao/goscrapy"
 	"github.com/jiandahao/goscrapy/pkg/broswer/chrome"
 	"github.com/tebeka/selenium"
+	"github.com/tebeka/selenium/log"
 	"go.uber.org/zap"
 )
 
@@ -21,10 +22,12 @@ type ChromeDownloader struct {
 	chromeCfg chrome.Config
 	// chromeEngine *chrome.Broswer
 	cache Cache
+	// networkLog indicates whether to attach all network activities to response.
+	networkLog bool
+	// cookieJar is shared with other downloaders, e.g. http client.
+	cookieJar http.CookieJar
 
-	sync.Mutex
-
-	broswer *chrome.Broswer
+	pool *BroswerPool
 }
 
 // Cache cache
@@ -33,20 +36,25 @@ type Cache interface {
 	Load(*goscrapy.Request) (*goscrapy.Response, error)
 }
 
-// NewChromeDownloader creates a downloader instance.
+// NewChromeDownloader creates a downloader instance with a single broswer.
 func NewChromeDownloader(cfg chrome.Config) (*ChromeDownloader, error) {
-	broswer, err := chrome.NewBroswer(cfg)
-	if err != nil {
-		return nil, err
-	}
+	return NewChromeDownloaderWithPool(cfg, PoolConfig{Size: 1})
+}
+
+// NewChromeDownloaderWithPool creates a downloader instance rendering pages with a pool
+// of broswers, so that pages could be downloaded concurrently.
+func NewChromeDownloaderWithPool(cfg chrome.Config, poolCfg PoolConfig) (*ChromeDownloader, error) {
+	// performance log is required to capture status code and headers of response.
+	cfg.PerformanceLog = true
 
-	if err := broswer.Open(); err != nil {
+	pool, err := NewBroswerPool(cfg, poolCfg)
+	if err != nil {
 		return nil, err
 	}
 
 	return &ChromeDownloader{
 		chromeCfg: cfg,
-		broswer:   broswer,
+		pool:      pool,
 	}, nil
 }
 
@@ -55,6 +63,25 @@ func (cd *ChromeDownloader) SetCache(c Cache) {
 	cd.cache = c
 }
 
+// SetNetworkLog set whether to attach the full network log (e.g. XHR requests
+// and responses) to Response.NetworkLog.
+func (cd *ChromeDownloader) SetNetworkLog(enable bool) {
+	cd.networkLog = enable
+}
+
+// SetCookieJar set cookie jar shared with other downloaders. Cookies in jar will be
+// loaded into broswer before fetching page, and cookies of broswer will be stored
+// into jar after fetching page.
+/* for example:
+jar, _ := cookiejar.New(nil)
+httpDownloader := &goscrapy.DefaultDownloader{}
+httpDownloader.SetHTTPClient(&http.Client{Jar: jar})
+chromeDownloader.SetCookieJar(jar)
+*/
+func (cd *ChromeDownloader) SetCookieJar(jar http.CookieJar) {
+	cd.cookieJar = jar
+}
+
 func (cd *ChromeDownloader) getFromCache(req *goscrapy.Request) *goscrapy.Response {
 	if cd.cache == nil {
 		return nil
@@ -86,22 +113,89 @@ func (cd *ChromeDownloader) Download(req *goscrapy.Request) (*goscrapy.Response,
 		return resp, nil
 	}
 
-	cd.Lock()
-	defer cd.Unlock()
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := cd.pool.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer cd.pool.Release(sess)
+
 	fmt.Printf("start to fetch page: %s\n", req.URL)
 
-	if err := cd.retryer(10, func() error {
-		if err := cd.broswer.Get(req.URL); err != nil {
+	var messages []log.Message
+	if err := cd.retryer(sess, 10, func() error {
+		// drain performance logs left by previous page
+		if _, err := sess.Log(log.Performance); err != nil {
 			return err
 		}
 
-		return nil
+		if cd.cookieJar != nil {
+			if err := loadCookies(sess, cd.cookieJar, u); err != nil {
+				return err
+			}
+
+			// drain performance logs caused by loading cookies
+			if _, err := sess.Log(log.Performance); err != nil {
+				return err
+			}
+		}
+
+		if err := sess.Get(req.URL); err != nil {
+			return err
+		}
+
+		var err error
+		messages, err = sess.Log(log.Performance)
+		return err
 	}); err != nil {
 		fmt.Printf("handle request failed: %v, %v\n", zap.Any("request", req), zap.Error(err))
 		return nil, err
 	}
 
-	elem, err := cd.broswer.WebDriver.FindElement(selenium.ByXPATH, "//*")
+	var scriptResults map[string]interface{}
+	if len(req.BrowserActions) > 0 {
+		tracker := newNetworkTracker()
+		tracker.add(messages)
+
+		scriptResults = make(map[string]interface{})
+		if err := performActions(sess, req.BrowserActions, scriptResults, tracker); err != nil {
+			return nil, err
+		}
+
+		// collects network activities caused by browser actions
+		if err := tracker.collect(sess); err != nil {
+			return nil, err
+		}
+		messages = tracker.messages
+	}
+
+	currentURL, err := sess.CurrentURL()
+	if err != nil {
+		currentURL = req.URL
+	}
+
+	if cd.cookieJar != nil {
+		// storing cookies against the final url, which may differ from u after redirects
+		final, err := url.Parse(currentURL)
+		if err != nil {
+			final = u
+		}
+
+		if err := saveCookies(sess, cd.cookieJar, final); err != nil {
+			return nil, err
+		}
+	}
+
+	artifacts, err := capture(sess, req.Capture)
+	if err != nil {
+		return nil, err
+	}
+
+	elem, err := sess.FindElement(selenium.ByXPATH, "//*")
 	if err != nil {
 		return nil, err
 	}
@@ -118,10 +212,26 @@ func (cd *ChromeDownloader) Download(req *goscrapy.Request) (*goscrapy.Response,
 	}
 
 	resp := &goscrapy.Response{
-		Request:    req,
-		Document:   doc,
-		Status:     "OK",
-		StatusCode: http.StatusOK,
+		Request:       req,
+		Document:      doc,
+		Body:          []byte(html),
+		ContentLength: int64(len(html)),
+		Status:        formatStatus(http.StatusOK, ""),
+		StatusCode:    http.StatusOK,
+		URL:           currentURL,
+		ScriptResults: scriptResults,
+		Artifacts:     artifacts,
+	}
+
+	netLog := parseNetworkLog(messages)
+	if doc := netLog.MainDocument(); doc != nil {
+		resp.Status = doc.Status
+		resp.StatusCode = doc.StatusCode
+		resp.Header = doc.ResponseHeader
+	}
+
+	if cd.networkLog {
+		resp.NetworkLog = netLog.Entries()
 	}
 
 	cd.setCache(resp)
@@ -129,7 +239,12 @@ func (cd *ChromeDownloader) Download(req *goscrapy.Request) (*goscrapy.Response,
 	return resp, nil
 }
 
-func (cd *ChromeDownloader) retryer(n int, h func() error) error {
+// Close closes all broswers used by downloader.
+func (cd *ChromeDownloader) Close() error {
+	return cd.pool.Close()
+}
+
+func (cd *ChromeDownloader) retryer(sess *BroswerSession, n int, h func() error) error {
 	handler := func() (err error) {
 		defer func() {
 			if r := recover(); r != nil {
@@ -148,8 +263,9 @@ func (cd *ChromeDownloader) retryer(n int, h func() error) error {
 		}
 
 		fmt.Printf("something wrong happens,cause: %v, restarting chrome: retry (%v / %v )\n", err, i+1, n)
-		cd.broswer.Close()
-		cd.broswer.Open()
+		if err := cd.pool.Recycle(sess); err != nil {
+			fmt.Printf("failed to restart chrome: %v\n", err)
+		}
 	}
 
 	return err
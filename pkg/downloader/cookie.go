@@ -0,0 +1,89 @@
+package downloader
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tebeka/selenium"
+)
+
+// loadCookies adds cookies stored in jar for u into broswer. Broswer only accepts
+// cookies of the domain it is currently visiting, so it navigates to a cheap page of
+// the same origin (i.e. /favicon.ico) first if broswer is on another host, rather than
+// u itself which would be fetched twice.
+func loadCookies(wd selenium.WebDriver, jar http.CookieJar, u *url.URL) error {
+	cookies := jar.Cookies(u)
+	if len(cookies) <= 0 {
+		return nil
+	}
+
+	current, err := wd.CurrentURL()
+	if err != nil {
+		return err
+	}
+
+	if cu, err := url.Parse(current); err != nil || cu.Host != u.Host {
+		origin := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/favicon.ico"}
+		if err := wd.Get(origin.String()); err != nil {
+			return err
+		}
+	}
+
+	existing, err := wd.GetCookies()
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string, len(existing))
+	for _, c := range existing {
+		values[c.Name] = c.Value
+	}
+
+	for _, c := range cookies {
+		if val, ok := values[c.Name]; ok && val == c.Value {
+			continue
+		}
+
+		if err := wd.AddCookie(&selenium.Cookie{
+			Name:   c.Name,
+			Value:  c.Value,
+			Path:   "/",
+			Secure: u.Scheme == "https",
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveCookies stores cookies of broswer for u into jar, u should be the url that broswer
+// is currently visiting (i.e. the final url after redirects), since broswer only returns
+// cookies of the current page.
+func saveCookies(wd selenium.WebDriver, jar http.CookieJar, u *url.URL) error {
+	cookies, err := wd.GetCookies()
+	if err != nil {
+		return err
+	}
+
+	var httpCookies []*http.Cookie
+	for _, c := range cookies {
+		hc := &http.Cookie{
+			Name:   c.Name,
+			Value:  c.Value,
+			Path:   c.Path,
+			Domain: c.Domain,
+			Secure: c.Secure,
+		}
+
+		if c.Expiry > 0 {
+			hc.Expires = time.Unix(int64(c.Expiry), 0)
+		}
+
+		httpCookies = append(httpCookies, hc)
+	}
+
+	jar.SetCookies(u, httpCookies)
+	return nil
+}
@@ -0,0 +1,213 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jiandahao/goscrapy"
+	"github.com/tebeka/selenium"
+	"github.com/tebeka/selenium/log"
+)
+
+// perfLogMessage represents a chrome performance log message, see
+// https://chromedevtools.github.io/devtools-protocol/tot/Network/ for more details.
+type perfLogMessage struct {
+	Message struct {
+		Method string          `json:"method"`
+		Params perfLogEventRaw `json:"params"`
+	} `json:"message"`
+}
+
+type perfLogEventRaw struct {
+	RequestID string `json:"requestId"`
+	LoaderID  string `json:"loaderId"`
+	FrameID   string `json:"frameId"`
+	Type      string `json:"type"`
+	Request   *struct {
+		URL     string                 `json:"url"`
+		Method  string                 `json:"method"`
+		Headers map[string]interface{} `json:"headers"`
+	} `json:"request"`
+	Response *struct {
+		URL        string                 `json:"url"`
+		Status     int                    `json:"status"`
+		StatusText string                 `json:"statusText"`
+		Headers    map[string]interface{} `json:"headers"`
+		MimeType   string                 `json:"mimeType"`
+	} `json:"response"`
+	ErrorText string `json:"errorText"`
+}
+
+// networkLog collects network activities from chrome performance logs.
+type networkLog struct {
+	entries      []*goscrapy.NetworkEntry
+	index        map[string]*goscrapy.NetworkEntry
+	mainFrame    string   // frame id of main frame
+	mainRequests []string // request ids of documents navigated in main frame, in order
+}
+
+// parseNetworkLog parses chrome performance logs into network entries.
+func parseNetworkLog(messages []log.Message) *networkLog {
+	nl := &networkLog{
+		index: make(map[string]*goscrapy.NetworkEntry),
+	}
+
+	for _, msg := range messages {
+		var m perfLogMessage
+		if err := json.Unmarshal([]byte(msg.Message), &m); err != nil {
+			continue
+		}
+
+		params := m.Message.Params
+		switch m.Message.Method {
+		case "Network.requestWillBeSent":
+			if params.Request == nil {
+				continue
+			}
+
+			// navigations (e.g. caused by browser actions) load new documents in main frame
+			if params.Type == "Document" && params.RequestID == params.LoaderID {
+				if nl.mainFrame == "" {
+					nl.mainFrame = params.FrameID
+				}
+
+				if params.FrameID == nl.mainFrame {
+					nl.mainRequests = append(nl.mainRequests, params.RequestID)
+				}
+			}
+
+			entry := nl.entry(params.RequestID)
+			entry.ResourceType = params.Type
+			entry.Method = params.Request.Method
+			entry.URL = params.Request.URL
+			entry.RequestHeader = toHTTPHeader(params.Request.Headers)
+		case "Network.responseReceived":
+			if params.Response == nil {
+				continue
+			}
+
+			entry := nl.entry(params.RequestID)
+			entry.ResourceType = params.Type
+			entry.URL = params.Response.URL
+			entry.StatusCode = params.Response.Status
+			entry.Status = formatStatus(params.Response.Status, params.Response.StatusText)
+			entry.ResponseHeader = toHTTPHeader(params.Response.Headers)
+			entry.MimeType = params.Response.MimeType
+		case "Network.loadingFailed":
+			entry := nl.entry(params.RequestID)
+			entry.Failed = true
+			entry.ErrorText = params.ErrorText
+		}
+	}
+
+	return nl
+}
+
+func (nl *networkLog) entry(requestID string) *goscrapy.NetworkEntry {
+	entry, ok := nl.index[requestID]
+	if !ok {
+		entry = &goscrapy.NetworkEntry{RequestID: requestID}
+		nl.index[requestID] = entry
+		nl.entries = append(nl.entries, entry)
+	}
+
+	return entry
+}
+
+// MainDocument returns network entry of the last document received by main frame, which is
+// the page finally rendered, or nil if not found.
+func (nl *networkLog) MainDocument() *goscrapy.NetworkEntry {
+	for i := len(nl.mainRequests) - 1; i >= 0; i-- {
+		// skipping documents whose response has not been received
+		if entry := nl.index[nl.mainRequests[i]]; entry.StatusCode != 0 {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// Entries returns all network entries in order of occurrence.
+func (nl *networkLog) Entries() []*goscrapy.NetworkEntry {
+	return nl.entries
+}
+
+// networkTracker collects chrome performance logs of page and tracks requests that are
+// still loading. Performance logs are cleared once read from broswer, so that all logs
+// should be read through tracker to be parsed into network log later.
+type networkTracker struct {
+	messages []log.Message
+	inflight map[string]struct{} // request ids of requests still loading
+}
+
+func newNetworkTracker() *networkTracker {
+	return &networkTracker{
+		inflight: make(map[string]struct{}),
+	}
+}
+
+// add records messages and updates requests that are still loading.
+func (nt *networkTracker) add(messages []log.Message) {
+	nt.messages = append(nt.messages, messages...)
+	for _, msg := range messages {
+		var m perfLogMessage
+		if err := json.Unmarshal([]byte(msg.Message), &m); err != nil {
+			continue
+		}
+
+		switch m.Message.Method {
+		case "Network.requestWillBeSent":
+			nt.inflight[m.Message.Params.RequestID] = struct{}{}
+		case "Network.loadingFinished", "Network.loadingFailed":
+			delete(nt.inflight, m.Message.Params.RequestID)
+		}
+	}
+}
+
+// collect reads new performance logs from broswer.
+func (nt *networkTracker) collect(wd selenium.WebDriver) error {
+	messages, err := wd.Log(log.Performance)
+	if err != nil {
+		return err
+	}
+
+	nt.add(messages)
+	return nil
+}
+
+// Inflight returns the number of requests that are still loading.
+func (nt *networkTracker) Inflight() int {
+	return len(nt.inflight)
+}
+
+// toHTTPHeader converts devtools headers into http.Header. Devtools joins
+// multiple values of the same header with "\n".
+func toHTTPHeader(headers map[string]interface{}) http.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	header := http.Header{}
+	for key, val := range headers {
+		str, ok := val.(string)
+		if !ok {
+			str = fmt.Sprint(val)
+		}
+
+		for _, v := range strings.Split(str, "\n") {
+			header.Add(key, v)
+		}
+	}
+
+	return header
+}
+
+func formatStatus(code int, text string) string {
+	if text == "" {
+		text = http.StatusText(code)
+	}
+
+	return fmt.Sprintf("%d %s", code, text)
+}
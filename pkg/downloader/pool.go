@@ -0,0 +1,251 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jiandahao/goscrapy/pkg/broswer/chrome"
+)
+
+// ErrPoolClosed is returned when acquiring broswer from a closed pool.
+var ErrPoolClosed = errors.New("broswer pool closed")
+
+// PoolConfig broswer pool config
+type PoolConfig struct {
+	// Size is the number of broswers in pool, 1 by default. Every broswer listens on
+	// its own port, that is chrome.Config.Port + index.
+	Size int
+	// MaxPages is the number of pages a broswer could fetch before being recycled,
+	// no limit if less or equals to 0.
+	MaxPages int
+	// IsolatedProfile creates a fresh profile directory for every broswer session,
+	// the profile will be removed once the session is recycled.
+	IsolatedProfile bool
+	// ProfileDir is the parent directory of isolated profiles, using the default
+	// temporary directory if empty.
+	ProfileDir string
+}
+
+// BroswerSession represents a broswer session acquired from pool.
+type BroswerSession struct {
+	*chrome.Broswer
+	index      int
+	pages      int
+	profileDir string
+}
+
+// BroswerPool manages a group of chrome broswers for concurrent rendering.
+type BroswerPool struct {
+	cfg      chrome.Config
+	poolCfg  PoolConfig
+	idle     chan *BroswerSession
+	sessions []*BroswerSession
+	mux      sync.Mutex
+	closed   bool
+}
+
+// NewBroswerPool creates a broswer pool and opens all broswers inside.
+func NewBroswerPool(cfg chrome.Config, poolCfg PoolConfig) (*BroswerPool, error) {
+	if poolCfg.Size <= 0 {
+		poolCfg.Size = 1
+	}
+
+	p := &BroswerPool{
+		cfg:     cfg,
+		poolCfg: poolCfg,
+		idle:    make(chan *BroswerSession, poolCfg.Size),
+	}
+
+	for i := 0; i < poolCfg.Size; i++ {
+		sess := &BroswerSession{index: i}
+		if err := p.open(sess); err != nil {
+			p.Close()
+			return nil, err
+		}
+
+		p.sessions = append(p.sessions, sess)
+		p.idle <- sess
+	}
+
+	return p, nil
+}
+
+// Size returns the number of broswers in pool, excluding broken ones that have been discarded.
+func (p *BroswerPool) Size() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return len(p.sessions)
+}
+
+// Acquire returns an idle broswer session, it blocks until there is one available.
+// Unhealthy broswer will be recycled before being returned, and discarded if failed
+// to recycle.
+func (p *BroswerPool) Acquire() (*BroswerSession, error) {
+	sess, ok := <-p.idle
+	if !ok {
+		return nil, ErrPoolClosed
+	}
+
+	p.mux.Lock()
+	closed := p.closed
+	p.mux.Unlock()
+	if closed {
+		p.close(sess)
+		return nil, ErrPoolClosed
+	}
+
+	if err := p.healthCheck(sess); err != nil {
+		fmt.Printf("broswer [%d] is unhealthy: %v, recycling\n", sess.index, err)
+		if err := p.Recycle(sess); err != nil {
+			p.discard(sess)
+			return nil, err
+		}
+	}
+
+	return sess, nil
+}
+
+// Release puts the session back into pool. Session will be recycled if it
+// has reached the maximum pages limit, and discarded if it's broken (i.e. failed
+// to recycle). Session will be closed if pool has been closed.
+func (p *BroswerPool) Release(sess *BroswerSession) {
+	if sess == nil {
+		return
+	}
+
+	sess.pages++
+	if p.poolCfg.MaxPages > 0 && sess.pages >= p.poolCfg.MaxPages {
+		if err := p.Recycle(sess); err != nil {
+			fmt.Printf("failed to recycle broswer [%d]: %v\n", sess.index, err)
+		}
+	}
+
+	if sess.Broswer == nil {
+		p.discard(sess)
+		return
+	}
+
+	p.mux.Lock()
+	if p.closed {
+		p.mux.Unlock()
+		p.close(sess)
+		return
+	}
+
+	p.idle <- sess
+	p.mux.Unlock()
+}
+
+// Recycle closes the broswer of session and reopens a fresh one. Session is broken
+// if failed to reopen, it will be discarded once released.
+func (p *BroswerPool) Recycle(sess *BroswerSession) error {
+	p.close(sess)
+	return p.open(sess)
+}
+
+// discard closes the broken session and removes it from pool. Pool will be closed once
+// all sessions have been discarded, so that Acquire won't block forever.
+func (p *BroswerPool) discard(sess *BroswerSession) {
+	p.close(sess)
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	for i, s := range p.sessions {
+		if s == sess {
+			p.sessions = append(p.sessions[:i], p.sessions[i+1:]...)
+			break
+		}
+	}
+
+	fmt.Printf("broswer [%d] is broken, discarded, %d broswers left\n", sess.index, len(p.sessions))
+	if len(p.sessions) == 0 && !p.closed {
+		p.closed = true
+		close(p.idle)
+	}
+}
+
+// Close closes idle broswers inside pool, broswers being used are closed once released.
+func (p *BroswerPool) Close() error {
+	p.mux.Lock()
+	if p.closed {
+		p.mux.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.idle)
+	p.mux.Unlock()
+
+	var err error
+	for sess := range p.idle {
+		if e := p.close(sess); e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+func (p *BroswerPool) healthCheck(sess *BroswerSession) error {
+	if sess.Broswer == nil || !sess.IsOpenned() {
+		return errors.New("broswer is not openned")
+	}
+
+	if _, err := sess.CurrentURL(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *BroswerPool) open(sess *BroswerSession) error {
+	cfg := p.cfg
+	cfg.Port = p.cfg.Port + sess.index
+
+	if p.poolCfg.IsolatedProfile {
+		dir, err := ioutil.TempDir(p.poolCfg.ProfileDir, fmt.Sprintf("goscrapy-profile-%d-", sess.index))
+		if err != nil {
+			return err
+		}
+		sess.profileDir = dir
+		cfg.UserDataDir = filepath.Clean(dir)
+	}
+
+	broswer, err := chrome.NewBroswer(cfg)
+	if err != nil {
+		p.removeProfile(sess)
+		return err
+	}
+
+	if err := broswer.Open(); err != nil {
+		p.removeProfile(sess)
+		return err
+	}
+
+	sess.Broswer = broswer
+	sess.pages = 0
+	return nil
+}
+
+func (p *BroswerPool) close(sess *BroswerSession) error {
+	var err error
+	if sess.Broswer != nil {
+		err = sess.Broswer.Close()
+		sess.Broswer = nil
+	}
+
+	p.removeProfile(sess)
+	return err
+}
+
+func (p *BroswerPool) removeProfile(sess *BroswerSession) {
+	if sess.profileDir != "" {
+		os.RemoveAll(sess.profileDir)
+		sess.profileDir = ""
+	}
+}
@@ -0,0 +1,331 @@
+// Package extract fills go structs from HTML documents declaratively by struct tags.
+//
+// Supported tags:
+//   css:"h1.title"          - CSS selector relative to the parent selection, the parent selection
+//                             itself will be used if empty.
+//   attr:"href"             - extract value of attribute instead of text, using attr:"html" to
+//                             extract inner HTML.
+//   regex:"price: (\d+)"    - apply regular expression on extracted value, the first submatch
+//                             will be used if there is any capturing group, otherwise the whole match.
+//   default:"0"             - default value if nothing extracted.
+//   layout:"2006-01-02"     - time layout for time.Time fields, RFC3339 by default.
+//   required:"true"         - report field as missing if nothing extracted.
+//
+// Nested structs are filled with the first element matched by css, slices are filled
+// with all matched elements, which is useful for repeated blocks.
+/* for example:
+type Product struct {
+	Title  string    `css:"h1.title" required:"true"`
+	Link   string    `css:"a.detail" attr:"href"`
+	Price  float64   `css:".price" regex:"([0-9.]+)" default:"0"`
+	Date   time.Time `css:".date" layout:"2006-01-02"`
+	Tags   []string  `css:".tags li"`
+	Offers []struct {
+		Seller string `css:".seller"`
+		Price  int    `css:".price"`
+	} `css:".offers .offer"`
+}
+
+var p Product
+report, err := extract.Document(ctx.Document(), &p)
+*/
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FieldError represents a field failed to be converted.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+// Error implements error
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", fe.Field, fe.Err)
+}
+
+// Report records the result of extraction.
+type Report struct {
+	Missing []string      // required fields that extracted nothing
+	Errors  []*FieldError // fields failed to be converted
+}
+
+// OK returns true if there is no missing required field or conversion error.
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Errors) == 0
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	regCache sync.Map // map[string]*regexp.Regexp
+)
+
+// Document fills v, which should be a pointer to struct, from HTML document.
+func Document(doc *goquery.Document, v interface{}) (*Report, error) {
+	if doc == nil {
+		return nil, errors.New("nil document")
+	}
+
+	return Selection(doc.Selection, v)
+}
+
+// Selection fills v, which should be a pointer to struct, from selection.
+func Selection(sel *goquery.Selection, v interface{}) (*Report, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("v should be a non-nil pointer to struct")
+	}
+
+	report := &Report{}
+	if err := fillStruct(sel, rv.Elem(), rv.Elem().Type().Name(), report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func fillStruct(sel *goquery.Selection, v reflect.Value, path string, report *Report) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+
+		selector, ok := field.Tag.Lookup("css")
+		if !ok {
+			continue
+		}
+
+		if err := fillField(sel, selector, field, v.Field(i), path+"."+field.Name, report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fillField(sel *goquery.Selection, selector string, field reflect.StructField, v reflect.Value, path string, report *Report) error {
+	target := sel
+	if selector != "" {
+		target = sel.Find(selector)
+	}
+
+	ft := field.Type
+	switch {
+	case ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8:
+		slice := reflect.MakeSlice(ft, 0, target.Length())
+		var err error
+		target.EachWithBreak(func(index int, s *goquery.Selection) bool {
+			elem := reflect.New(ft.Elem()).Elem()
+			ok, e := fillValue(s, field, elem, fmt.Sprintf("%s[%d]", path, index), report)
+			if e != nil {
+				err = e
+				return false
+			}
+
+			if ok {
+				slice = reflect.Append(slice, elem)
+			}
+			return true
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if slice.Len() == 0 && field.Tag.Get("required") == "true" {
+			report.Missing = append(report.Missing, path)
+		}
+
+		v.Set(slice)
+		return nil
+	default:
+		ok, err := fillValue(target.First(), field, v, path, report)
+		if err != nil {
+			return err
+		}
+
+		if !ok && field.Tag.Get("required") == "true" {
+			report.Missing = append(report.Missing, path)
+		}
+
+		return nil
+	}
+}
+
+// fillValue fills v from selection, it returns true if anything extracted.
+func fillValue(sel *goquery.Selection, field reflect.StructField, v reflect.Value, path string, report *Report) (bool, error) {
+	if v.Kind() == reflect.Ptr && v.Type().Elem() != timeType && v.Type().Elem().Kind() == reflect.Struct {
+		if sel.Length() == 0 {
+			return false, nil
+		}
+
+		elem := reflect.New(v.Type().Elem())
+		if err := fillStruct(sel, elem.Elem(), path, report); err != nil {
+			return false, err
+		}
+		v.Set(elem)
+		return true, nil
+	}
+
+	if v.Kind() == reflect.Struct && v.Type() != timeType {
+		if sel.Length() == 0 {
+			return false, nil
+		}
+		return true, fillStruct(sel, v, path, report)
+	}
+
+	str, ok, err := extractString(sel, field)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		def, hasDefault := field.Tag.Lookup("default")
+		if !hasDefault {
+			return false, nil
+		}
+		str = def
+	}
+
+	if err := setValue(v, str, field.Tag.Get("layout")); err != nil {
+		report.Errors = append(report.Errors, &FieldError{Field: path, Err: err})
+		return false, nil
+	}
+
+	return ok, nil
+}
+
+// extractString extracts string from selection as specified by attr and regex tags,
+// it returns false if nothing extracted.
+func extractString(sel *goquery.Selection, field reflect.StructField) (string, bool, error) {
+	if sel.Length() == 0 {
+		return "", false, nil
+	}
+
+	var str string
+	switch attr := field.Tag.Get("attr"); attr {
+	case "":
+		str = strings.TrimSpace(sel.Text())
+	case "html":
+		html, err := sel.Html()
+		if err != nil {
+			return "", false, err
+		}
+		str = strings.TrimSpace(html)
+	default:
+		val, ok := sel.Attr(attr)
+		if !ok {
+			return "", false, nil
+		}
+		str = strings.TrimSpace(val)
+	}
+
+	if pattern, ok := field.Tag.Lookup("regex"); ok {
+		reg, err := compile(pattern)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid regex of field %s: %v", field.Name, err)
+		}
+
+		match := reg.FindStringSubmatch(str)
+		if match == nil {
+			return "", false, nil
+		}
+
+		str = match[0]
+		if len(match) > 1 {
+			str = match[1]
+		}
+	}
+
+	return str, str != "", nil
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if val, ok := regCache.Load(pattern); ok {
+		return val.(*regexp.Regexp), nil
+	}
+
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regCache.Store(pattern, reg)
+	return reg, nil
+}
+
+// setValue converts str into the type of v.
+func setValue(v reflect.Value, str string, layout string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), str, layout); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		if layout == "" {
+			layout = time.RFC3339
+		}
+
+		t, err := time.Parse(layout, str)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(str)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.Replace(str, ",", "", -1), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.Replace(str, ",", "", -1), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.Replace(str, ",", "", -1), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type: %s", v.Type())
+		}
+		v.SetBytes([]byte(str))
+	default:
+		return fmt.Errorf("unsupported type: %s", v.Type())
+	}
+
+	return nil
+}
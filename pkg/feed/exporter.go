@@ -0,0 +1,301 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Exporter exports items into writer in certain format.
+type Exporter interface {
+	Start(w io.Writer) error                  // called before exporting the first item
+	Export(item map[string]interface{}) error // export an item
+	Finish() error                            // called after exporting the last item
+}
+
+// Format feed format
+type Format string
+
+// all supported feed formats
+const (
+	FormatJSONLines Format = "jsonlines"
+	FormatJSON      Format = "json"
+	FormatCSV       Format = "csv"
+	FormatXML       Format = "xml"
+)
+
+// NewExporter creates an exporter of format. Fields specifies fields to export and
+// their order, all fields will be exported if empty.
+func NewExporter(format Format, fields []string) (Exporter, error) {
+	switch format {
+	case FormatJSONLines:
+		return &JSONLinesExporter{fields: fields}, nil
+	case FormatJSON:
+		return &JSONExporter{fields: fields}, nil
+	case FormatCSV:
+		return &CSVExporter{fields: fields}, nil
+	case FormatXML:
+		return &XMLExporter{fields: fields}, nil
+	default:
+		return nil, fmt.Errorf("unsupported feed format: %s", format)
+	}
+}
+
+// JSONLinesExporter exports items in JSON Lines format, one item per line.
+type JSONLinesExporter struct {
+	w      io.Writer
+	fields []string
+}
+
+// Start starts exporting
+func (e *JSONLinesExporter) Start(w io.Writer) error {
+	e.w = w
+	return nil
+}
+
+// Export exports item
+func (e *JSONLinesExporter) Export(item map[string]interface{}) error {
+	data, err := marshalJSON(selectFields(item, e.fields))
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(data)
+	return err
+}
+
+// Finish finishes exporting
+func (e *JSONLinesExporter) Finish() error {
+	return nil
+}
+
+// JSONExporter exports items as a JSON array.
+type JSONExporter struct {
+	w      io.Writer
+	fields []string
+	count  int
+}
+
+// Start starts exporting
+func (e *JSONExporter) Start(w io.Writer) error {
+	e.w = w
+	e.count = 0
+	_, err := io.WriteString(w, "[")
+	return err
+}
+
+// Export exports item
+func (e *JSONExporter) Export(item map[string]interface{}) error {
+	data, err := marshalJSON(selectFields(item, e.fields))
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n"
+	if e.count == 0 {
+		sep = "\n"
+	}
+	e.count++
+
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(bytes.TrimSuffix(data, []byte("\n")))
+	return err
+}
+
+// Finish finishes exporting
+func (e *JSONExporter) Finish() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+// CSVExporter exports items in CSV format. Columns are inferred from the first
+// item in alphabetical order if fields are not specified, and kept for all the
+// following items and batches, keys not in columns are ignored.
+type CSVExporter struct {
+	w             *csv.Writer
+	fields        []string
+	header        []string
+	headerWritten bool
+}
+
+// Start starts exporting
+func (e *CSVExporter) Start(w io.Writer) error {
+	e.w = csv.NewWriter(w)
+	if len(e.header) == 0 {
+		e.header = e.fields
+	}
+	e.headerWritten = false
+	return nil
+}
+
+// Export exports item
+func (e *CSVExporter) Export(item map[string]interface{}) error {
+	if len(e.header) == 0 {
+		e.header = sortedKeys(item)
+	}
+
+	if !e.headerWritten {
+		if err := e.w.Write(e.header); err != nil {
+			return err
+		}
+		e.headerWritten = true
+	}
+
+	row := make([]string, len(e.header))
+	for index, field := range e.header {
+		row[index] = formatValue(item[field])
+	}
+
+	return e.w.Write(row)
+}
+
+// Flush writes buffered rows into the underlying writer.
+func (e *CSVExporter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// Finish finishes exporting
+func (e *CSVExporter) Finish() error {
+	return e.Flush()
+}
+
+// XMLExporter exports items in XML format. Fields are exported as elements named
+// by their keys, characters that are not allowed in element names are replaced by "_".
+type XMLExporter struct {
+	w      io.Writer
+	fields []string
+}
+
+// Start starts exporting
+func (e *XMLExporter) Start(w io.Writer) error {
+	e.w = w
+	_, err := io.WriteString(w, xml.Header+"<items>\n")
+	return err
+}
+
+// Export exports item
+func (e *XMLExporter) Export(item map[string]interface{}) error {
+	fields := e.fields
+	if len(fields) == 0 {
+		fields = sortedKeys(item)
+	}
+
+	if _, err := io.WriteString(e.w, "  <item>\n"); err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		val, ok := item[field]
+		if !ok {
+			continue
+		}
+
+		name := xmlName(field)
+		if _, err := fmt.Fprintf(e.w, "    <%s>", name); err != nil {
+			return err
+		}
+
+		if err := xml.EscapeText(e.w, []byte(formatValue(val))); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(e.w, "</%s>\n", name); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(e.w, "  </item>\n")
+	return err
+}
+
+// Finish finishes exporting
+func (e *XMLExporter) Finish() error {
+	_, err := io.WriteString(e.w, "</items>\n")
+	return err
+}
+
+// xmlName converts key into a valid XML element name.
+func xmlName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, key)
+
+	// names must start with a letter or underscore, and must not start with "xml"
+	if first := []rune(name + "0")[0]; !unicode.IsLetter(first) && first != '_' || strings.HasPrefix(strings.ToLower(name), "xml") {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// selectFields returns the item only containing fields, or item itself if fields is empty.
+func selectFields(item map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return item
+	}
+
+	res := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if val, ok := item[field]; ok {
+			res[field] = val
+		}
+	}
+
+	return res
+}
+
+// marshalJSON returns the JSON encoding of v ending with a newline, HTML characters
+// will not be escaped.
+func marshalJSON(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sortedKeys(item map[string]interface{}) []string {
+	keys := make([]string, 0, len(item))
+	for key := range item {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue formats value as string, non-scalar value will be formatted as JSON.
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	default:
+		data, err := marshalJSON(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(bytes.TrimSuffix(data, []byte("\n")))
+	}
+}
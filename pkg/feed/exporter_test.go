@@ -0,0 +1,135 @@
+package feed
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExporters(t *testing.T) {
+	items := []map[string]interface{}{
+		{"title": "a <b>", "price": 1.5, "tags": []string{"x", "y"}},
+		{"title": "c, \"d\"", "stock": 3, "1st": true},
+	}
+
+	cases := []struct {
+		name   string
+		format Format
+		fields []string
+		want   string
+	}{
+		{
+			name:   "json lines",
+			format: FormatJSONLines,
+			want: `{"price":1.5,"tags":["x","y"],"title":"a <b>"}
+{"1st":true,"stock":3,"title":"c, \"d\""}
+`,
+		},
+		{
+			name:   "json lines with fields",
+			format: FormatJSONLines,
+			fields: []string{"title"},
+			want: `{"title":"a <b>"}
+{"title":"c, \"d\""}
+`,
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			want: `[
+{"price":1.5,"tags":["x","y"],"title":"a <b>"},
+{"1st":true,"stock":3,"title":"c, \"d\""}
+]
+`,
+		},
+		{
+			name:   "csv with inferred columns",
+			format: FormatCSV,
+			want: `price,tags,title
+1.5,"[""x"",""y""]",a <b>
+,,"c, ""d"""
+`,
+		},
+		{
+			name:   "csv with fields",
+			format: FormatCSV,
+			fields: []string{"title", "stock"},
+			want: `title,stock
+a <b>,
+"c, ""d""",3
+`,
+		},
+		{
+			name:   "xml",
+			format: FormatXML,
+			fields: []string{"title", "1st", "stock"},
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<items>
+  <item>
+    <title>a &lt;b&gt;</title>
+  </item>
+  <item>
+    <title>c, &#34;d&#34;</title>
+    <_1st>true</_1st>
+    <stock>3</stock>
+  </item>
+</items>
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			exporter, err := NewExporter(c.format, c.fields)
+			if err != nil {
+				t.Fatalf("NewExporter error: %v", err)
+			}
+
+			buf := &bytes.Buffer{}
+			if err := exporter.Start(buf); err != nil {
+				t.Fatalf("Start error: %v", err)
+			}
+
+			for _, item := range items {
+				if err := exporter.Export(item); err != nil {
+					t.Fatalf("Export error: %v", err)
+				}
+			}
+
+			if err := exporter.Finish(); err != nil {
+				t.Fatalf("Finish error: %v", err)
+			}
+
+			if got := buf.String(); got != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNewExporterInvalid(t *testing.T) {
+	if _, err := NewExporter("yaml", nil); err == nil {
+		t.Errorf("NewExporter(yaml) succeeded, want error")
+	}
+}
+
+func TestXMLName(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "title", want: "title"},
+		{in: "first name", want: "first_name"},
+		{in: "a:b", want: "a_b"},
+		{in: "1st", want: "_1st"},
+		{in: "-a", want: "_-a"},
+		{in: "xmlns", want: "_xmlns"},
+		{in: "XMLData", want: "_XMLData"},
+		{in: "", want: "_"},
+	}
+
+	for _, c := range cases {
+		if got := xmlName(c.in); got != c.want {
+			t.Errorf("xmlName(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// Package feed implements feed exports, which store scraped items into files
+// in formats of JSON Lines, JSON, CSV and XML.
+package feed
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jiandahao/goscrapy"
+)
+
+// TimeFormat is the format of %(time)s parameter in uri template.
+const TimeFormat = "2006-01-02T15-04-05"
+
+// Config feed config
+type Config struct {
+	// URI is the uri template of feed storage, it supports the following parameters:
+	//   %(spider)s   - name of spider that generated items
+	//   %(name)s     - name of items
+	//   %(time)s     - time when the file is created, formatted as TimeFormat
+	//   %(batch_id)d - sequence number of batch, starts from 1
+	// e.g. file:///out/%(spider)s/%(time)s.jsonl
+	URI    string
+	Format Format
+	// ItemList are names of items exported into this feed, all items handled by
+	// pipeline will be exported if empty.
+	ItemList []string
+	// Fields specifies fields to export and their order. For CSV, columns will be
+	// inferred from the first item in alphabetical order if empty.
+	Fields []string
+	// BatchItemCount starts a new file once the number of items in file reaches
+	// the limit, no limit if less or equals to 0. URI must contain %(batch_id)d if set.
+	BatchItemCount int
+	// BatchSize starts a new file once the size (in bytes, before compression) of
+	// file reaches the limit, no limit if less or equals to 0. URI must contain %(batch_id)d if set.
+	BatchSize int64
+	// Gzip compresses the file using gzip.
+	Gzip bool
+	// Overwrite overwrites files existing before crawling. Otherwise creating a file that
+	// already exists fails, so that data won't be lost silently.
+	Overwrite bool
+}
+
+var _ goscrapy.Pipeline = &Pipeline{}
+var _ goscrapy.PipelineOpener = &Pipeline{}
+var _ goscrapy.PipelineCloser = &Pipeline{}
+
+// Pipeline feed export pipeline, it exports items into feeds.
+//
+// for example:
+/*
+p, err := feed.NewPipeline([]string{"product"}, feed.Config{
+	URI:            "file:///out/%(spider)s/%(name)s-%(batch_id)03d.jsonl.gz",
+	Format:         feed.FormatJSONLines,
+	BatchItemCount: 10000,
+	Gzip:           true,
+})
+if err != nil {
+	panic(err)
+}
+
+eng.RegisterPipelines(p) // feeds will be closed once crawling finished
+*/
+type Pipeline struct {
+	itemList []string
+	feeds    []*feed
+	refs     int // number of spiders opened the pipeline
+	mux      sync.Mutex
+}
+
+// NewPipeline creates a feed export pipeline handling items of itemList.
+func NewPipeline(itemList []string, configs ...Config) (*Pipeline, error) {
+	p := &Pipeline{itemList: itemList}
+	for _, cfg := range configs {
+		if cfg.URI == "" {
+			return nil, fmt.Errorf("missing feed uri")
+		}
+
+		if (cfg.BatchItemCount > 0 || cfg.BatchSize > 0) && !hasURIParam(cfg.URI, "batch_id") {
+			return nil, fmt.Errorf("feed uri %s must contain %%(batch_id)d when splitting into batches", cfg.URI)
+		}
+
+		// make sure format is valid
+		if _, err := NewExporter(cfg.Format, cfg.Fields); err != nil {
+			return nil, err
+		}
+
+		items := make(map[string]struct{}, len(cfg.ItemList))
+		for _, name := range cfg.ItemList {
+			items[name] = struct{}{}
+		}
+
+		p.feeds = append(p.feeds, &feed{
+			cfg:      cfg,
+			items:    items,
+			slots:    make(map[string]*slot),
+			finished: make(map[string]struct{}),
+		})
+	}
+
+	return p, nil
+}
+
+// Name returns pipeline's name
+func (p *Pipeline) Name() string {
+	return "feed_export_pipeline"
+}
+
+// ItemList returns all items' name that this pipeline cares about
+func (p *Pipeline) ItemList() []string {
+	return p.itemList
+}
+
+// Handle exports items into all feeds accepting it, typed items are exported with the key
+// of their json tag names (see goscrapy.ToItems).
+func (p *Pipeline) Handle(items *goscrapy.Items) error {
+	data := goscrapy.ItemToMap(items)
+	for _, f := range p.feeds {
+		if err := f.export(items.SpiderName(), items.ItemName(), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Open records the spider exporting items into feeds, it's called by engine before crawling.
+func (p *Pipeline) Open(ctx context.Context, spider goscrapy.Spider) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.refs++
+	return nil
+}
+
+// Close is called by engine once spider has been closed. Files of the spider (i.e. uri
+// containing %(spider)s) are finished, while files shared by spiders are finished once
+// all spiders have been closed. All feeds are finished if spider is nil.
+func (p *Pipeline) Close(ctx context.Context, spider goscrapy.Spider) error {
+	p.mux.Lock()
+	p.refs--
+	all := p.refs <= 0 || spider == nil
+	p.mux.Unlock()
+
+	var name string
+	if !all {
+		name = spider.Name()
+	}
+
+	var err error
+	for _, f := range p.feeds {
+		if e := f.close(name); e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+type feed struct {
+	cfg      Config
+	items    map[string]struct{}
+	slots    map[string]*slot    // feeds might be split into multiple files by spider or item name
+	finished map[string]struct{} // paths of files that have been finished
+	mux      sync.Mutex
+}
+
+func (f *feed) export(spider, name string, item map[string]interface{}) error {
+	if len(f.items) > 0 {
+		if _, ok := f.items[name]; !ok {
+			return nil
+		}
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	params := map[string]interface{}{}
+	if hasURIParam(f.cfg.URI, "spider") {
+		params["spider"] = spider
+	}
+
+	if hasURIParam(f.cfg.URI, "name") {
+		params["name"] = name
+	}
+
+	key := fmt.Sprintf("%v\x00%v", params["spider"], params["name"])
+	s, ok := f.slots[key]
+	if !ok {
+		s = &slot{cfg: f.cfg, params: params, finished: f.finished}
+		f.slots[key] = s
+	}
+
+	return s.export(item)
+}
+
+// close finishes files of spider, or all files if spider is empty.
+func (f *feed) close(spider string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	var err error
+	for _, s := range f.slots {
+		if spider != "" && s.params["spider"] != spider {
+			continue
+		}
+
+		if e := s.finish(); e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// slot represents a file of feed being written.
+type slot struct {
+	cfg      Config
+	params   map[string]interface{}
+	finished map[string]struct{} // shared with feed
+	batchID  int
+	path     string
+	file     *os.File
+	gz       *gzip.Writer
+	counter  *countingWriter
+	exporter Exporter
+	count    int
+}
+
+func (s *slot) export(item map[string]interface{}) error {
+	if s.file == nil {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.exporter.Export(item); err != nil {
+		return err
+	}
+	s.count++
+
+	if s.cfg.BatchSize > 0 {
+		// flushing buffered data (e.g. of csv writer) so that the size is accurate
+		if f, ok := s.exporter.(flusher); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if (s.cfg.BatchItemCount > 0 && s.count >= s.cfg.BatchItemCount) ||
+		(s.cfg.BatchSize > 0 && s.counter.n >= s.cfg.BatchSize) {
+		return s.finish()
+	}
+
+	return nil
+}
+
+func (s *slot) start() error {
+	s.batchID++
+	s.params["batch_id"] = s.batchID
+	s.params["time"] = time.Now().Format(TimeFormat)
+
+	path := renderURI(s.cfg.URI, s.params)
+	if _, ok := s.finished[path]; ok {
+		// reopening would overwrite items exported before
+		return fmt.Errorf("feed %s has been finished, using %%(batch_id)d in uri to split files", path)
+	}
+
+	file, err := openURI(path, s.cfg.Overwrite)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = file
+	if s.cfg.Gzip {
+		s.gz = gzip.NewWriter(file)
+		w = s.gz
+	}
+
+	s.counter = &countingWriter{w: w}
+
+	// reusing exporter across batches, so that columns inferred from the first item are kept
+	if s.exporter == nil {
+		s.exporter, err = NewExporter(s.cfg.Format, s.cfg.Fields)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := s.exporter.Start(s.counter); err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.path = path
+	s.count = 0
+	return nil
+}
+
+func (s *slot) finish() error {
+	if s.file == nil {
+		return nil
+	}
+
+	defer func() {
+		s.finished[s.path] = struct{}{}
+		s.file = nil
+		s.gz = nil
+	}()
+
+	if err := s.exporter.Finish(); err != nil {
+		s.file.Close()
+		return err
+	}
+
+	if s.gz != nil {
+		if err := s.gz.Close(); err != nil {
+			s.file.Close()
+			return err
+		}
+	}
+
+	return s.file.Close()
+}
+
+// flusher is implemented by exporters buffering data.
+type flusher interface {
+	Flush() error
+}
+
+// countingWriter counts bytes written into w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,308 @@
+package feed
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jiandahao/goscrapy"
+)
+
+type testSpider struct {
+	name string
+}
+
+func (s *testSpider) Name() string                       { return s.name }
+func (s *testSpider) StartRequests() []*goscrapy.Request { return nil }
+func (s *testSpider) URLMatcher() goscrapy.URLMatcher    { return nil }
+func (s *testSpider) Parse(ctx *goscrapy.Context) (*goscrapy.Items, []*goscrapy.Request, error) {
+	return nil, nil, nil
+}
+
+func TestRenderURI(t *testing.T) {
+	params := map[string]interface{}{"spider": "books", "name": "book", "batch_id": 7}
+
+	cases := []struct {
+		tmpl string
+		want string
+	}{
+		{tmpl: "file:///out/%(spider)s/%(name)s.jsonl", want: "file:///out/books/book.jsonl"},
+		{tmpl: "out-%(batch_id)d.csv", want: "out-7.csv"},
+		{tmpl: "out-%(batch_id)03d.csv", want: "out-007.csv"},
+		{tmpl: "%(name)5s.xml", want: " book.xml"},
+		{tmpl: "%(unknown)s.xml", want: "%(unknown)s.xml"},
+		{tmpl: "%(spider)d.xml", want: "books.xml"},
+	}
+
+	for _, c := range cases {
+		if got := renderURI(c.tmpl, params); got != c.want {
+			t.Errorf("renderURI(%q) = %q, want %q", c.tmpl, got, c.want)
+		}
+	}
+
+	if !hasURIParam("out-%(batch_id)03d.csv", "batch_id") || hasURIParam("out-%(batch)s.csv", "batch_id") {
+		t.Errorf("hasURIParam returns wrong result")
+	}
+}
+
+func TestNewPipelineInvalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Format: FormatJSONLines},
+		{URI: "out.jsonl", Format: "yaml"},
+		{URI: "out.jsonl", Format: FormatJSONLines, BatchItemCount: 10},
+		{URI: "out.jsonl", Format: FormatJSONLines, BatchSize: 1024},
+	} {
+		if _, err := NewPipeline(nil, cfg); err == nil {
+			t.Errorf("NewPipeline(%+v) succeeded, want error", cfg)
+		}
+	}
+}
+
+// export exports item of spider into all feeds of pipeline, as engine sets spider name of items.
+func export(t *testing.T, p *Pipeline, spider, name string, item map[string]interface{}) {
+	t.Helper()
+
+	for _, f := range p.feeds {
+		if err := f.export(spider, name, item); err != nil {
+			t.Fatalf("export error: %v", err)
+		}
+	}
+}
+
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func TestPipeline(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPipeline(nil,
+		Config{
+			URI:            "file://" + filepath.ToSlash(dir) + "/%(spider)s/%(name)s-%(batch_id)d.csv",
+			Format:         FormatCSV,
+			BatchItemCount: 2,
+		},
+		Config{
+			URI:      filepath.Join(dir, "all.jsonl"),
+			Format:   FormatJSONLines,
+			ItemList: []string{"book"},
+			Fields:   []string{"title"},
+		},
+	)
+	if err != nil {
+		t.Fatalf("NewPipeline error: %v", err)
+	}
+
+	books, movies := &testSpider{name: "books"}, &testSpider{name: "movies"}
+	ctx := context.Background()
+	p.Open(ctx, books)
+	p.Open(ctx, movies)
+
+	export(t, p, "books", "book", map[string]interface{}{"title": "a", "price": 1})
+	export(t, p, "books", "book", map[string]interface{}{"title": "b", "price": 2})
+	// columns of the first batch are kept, extra keys are ignored
+	export(t, p, "books", "book", map[string]interface{}{"title": "c", "author": "x"})
+	export(t, p, "movies", "movie", map[string]interface{}{"title": "d"})
+
+	if err := p.Close(ctx, books); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	// files of books are finished once books closed, while shared files are still being written
+	files := readFiles(t, dir)
+	if got, want := files["books/book-2.csv"], "price,title\n,c\n"; got != want {
+		t.Errorf("books/book-2.csv = %q, want %q", got, want)
+	}
+
+	if got := files["movies/movie-1.csv"]; got != "" {
+		t.Errorf("movies/movie-1.csv = %q before movies closed, want empty", got)
+	}
+
+	if err := p.Close(ctx, movies); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	files = readFiles(t, dir)
+	want := map[string]string{
+		"books/book-1.csv":   "price,title\n1,a\n2,b\n",
+		"books/book-2.csv":   "price,title\n,c\n",
+		"movies/movie-1.csv": "title\nd\n",
+		"all.jsonl":          "{\"title\":\"a\"}\n{\"title\":\"b\"}\n{\"title\":\"c\"}\n",
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(files) != len(want) {
+		t.Errorf("got files %v, want %d files", names, len(want))
+	}
+
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s = %q, want %q", name, files[name], content)
+		}
+	}
+}
+
+func TestPipelineBatchSize(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPipeline(nil, Config{
+		URI:       filepath.Join(dir, "items-%(batch_id)d.jsonl"),
+		Format:    FormatJSONLines,
+		BatchSize: 20,
+	})
+	if err != nil {
+		t.Fatalf("NewPipeline error: %v", err)
+	}
+
+	for _, title := range []string{"first", "second", "third"} {
+		items := goscrapy.NewItems("book")
+		items.Store("title", title)
+		if err := p.Handle(items); err != nil {
+			t.Fatalf("Handle error: %v", err)
+		}
+	}
+
+	if err := p.Close(context.Background(), nil); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	files := readFiles(t, dir)
+	want := map[string]string{
+		"items-1.jsonl": "{\"title\":\"first\"}\n{\"title\":\"second\"}\n",
+		"items-2.jsonl": "{\"title\":\"third\"}\n",
+	}
+
+	if len(files) != len(want) {
+		t.Errorf("got %d files, want %d", len(files), len(want))
+	}
+
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s = %q, want %q", name, files[name], content)
+		}
+	}
+}
+
+func TestPipelineGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.json.gz")
+	p, err := NewPipeline(nil, Config{URI: path, Format: FormatJSON, Gzip: true})
+	if err != nil {
+		t.Fatalf("NewPipeline error: %v", err)
+	}
+
+	items := goscrapy.NewItems("book")
+	items.Store("title", "a")
+	if err := p.Handle(items); err != nil {
+		t.Fatalf("Handle error: %v", err)
+	}
+
+	if err := p.Close(context.Background(), nil); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	fd, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	r, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatalf("gzip.NewReader error: %v", err)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(data), "[\n{\"title\":\"a\"}\n]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPipelineOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.jsonl")
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handle := func(overwrite bool) error {
+		p, err := NewPipeline(nil, Config{URI: path, Format: FormatJSONLines, Overwrite: overwrite})
+		if err != nil {
+			t.Fatalf("NewPipeline error: %v", err)
+		}
+
+		items := goscrapy.NewItems("book")
+		items.Store("title", "a")
+		if err := p.Handle(items); err != nil {
+			return err
+		}
+		return p.Close(context.Background(), nil)
+	}
+
+	if err := handle(false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Handle error = %v, want file already exists", err)
+	}
+
+	if err := handle(true); err != nil {
+		t.Fatalf("Handle error: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if got, want := string(data), "{\"title\":\"a\"}\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPipelineReopenFinished(t *testing.T) {
+	p, err := NewPipeline(nil, Config{
+		URI:    filepath.Join(t.TempDir(), "%(spider)s.jsonl"),
+		Format: FormatJSONLines,
+	})
+	if err != nil {
+		t.Fatalf("NewPipeline error: %v", err)
+	}
+
+	spider := &testSpider{name: "books"}
+	p.Open(context.Background(), spider)
+	p.Open(context.Background(), &testSpider{name: "movies"})
+	export(t, p, "books", "book", map[string]interface{}{"title": "a"})
+	if err := p.Close(context.Background(), spider); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	// exporting into a finished file would overwrite items exported before
+	if err := p.feeds[0].export("books", "book", map[string]interface{}{"title": "b"}); err == nil {
+		t.Errorf("export into finished feed succeeded, want error")
+	}
+}
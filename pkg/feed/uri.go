@@ -0,0 +1,81 @@
+package feed
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// uriParamReg matches printf-style named parameters, e.g. %(spider)s or %(batch_id)05d.
+var uriParamReg = regexp.MustCompile(`%\((\w+)\)([0-9]*[sd])`)
+
+// renderURI replaces named parameters inside uri template with params.
+// Unknown parameters are left as it is.
+func renderURI(tmpl string, params map[string]interface{}) string {
+	return uriParamReg.ReplaceAllStringFunc(tmpl, func(s string) string {
+		match := uriParamReg.FindStringSubmatch(s)
+		val, ok := params[match[1]]
+		if !ok {
+			return s
+		}
+
+		verb := match[2]
+		if strings.HasSuffix(verb, "d") {
+			if n, err := strconv.Atoi(fmt.Sprint(val)); err == nil {
+				return fmt.Sprintf("%"+verb, n)
+			}
+			verb = strings.TrimSuffix(verb, "d") + "s"
+		}
+
+		return fmt.Sprintf("%"+verb, fmt.Sprint(val))
+	})
+}
+
+// hasURIParam returns true if uri template contains the named parameter.
+func hasURIParam(tmpl string, name string) bool {
+	for _, match := range uriParamReg.FindAllStringSubmatch(tmpl, -1) {
+		if match[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// openURI creates the local file represented by uri for writing, parent directories
+// will be created if not exists. uri could be either a file uri (e.g. file:///out/items.jsonl)
+// or a local path. It fails if file already exists unless overwrite is true.
+func openURI(uri string, overwrite bool) (*os.File, error) {
+	path := uri
+	if strings.Contains(uri, "://") {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Scheme != "file" {
+			return nil, fmt.Errorf("unsupported feed storage: %s", u.Scheme)
+		}
+
+		path = u.Path
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_EXCL
+	if overwrite {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flag, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("feed %s already exists, set Config.Overwrite to overwrite it", path)
+	}
+
+	return file, err
+}
@@ -0,0 +1,253 @@
+// Package incremental implements incremental crawling, which skips pages and items that
+// have not changed since previous crawls.
+package incremental
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jiandahao/goscrapy"
+)
+
+// statuses of pages and items
+const (
+	StatusNew       = "new"       // never seen in previous crawls
+	StatusChanged   = "changed"   // changed since the previous crawl
+	StatusUnchanged = "unchanged" // same as the previous crawl
+)
+
+// ContextKeyStatus is the context key of request holding the status of page, spiders
+// could read it by Request.ContextValue.
+const ContextKeyStatus = "incremental_status"
+
+// Config incremental config
+type Config struct {
+	// Store persists records across crawls.
+	Store Store
+	// Matcher matches urls of pages that are crawled incrementally, e.g. detail pages.
+	// All pages are matched if nil. Listing pages are usually excluded so that links of
+	// new pages could always be found.
+	Matcher goscrapy.URLMatcher
+	// ItemList are names of items that will be marked with status.
+	ItemList []string
+	// KeyField is the item key holding the value identifying item, "url" by default.
+	// Items without key field are identified by their content, which means they are
+	// either new or unchanged.
+	KeyField string
+	// StatusField is the item key that status of item will be written to, "_status" by default.
+	StatusField string
+	// DropUnchanged drops unchanged items so that the following pipelines only receive deltas.
+	DropUnchanged bool
+}
+
+var _ goscrapy.Pipeline = &Incremental{}
+var _ goscrapy.PipelineCloser = &Incremental{}
+
+// Incremental skips pages and items that have not changed since previous crawls. ETag,
+// Last-Modified and content hash of pages are recorded, so that following crawls send
+// conditional requests, and responses of 304 or unchanged bodies are not parsed. As a
+// pipeline, it marks items as new, changed or unchanged so that pipelines could write
+// only deltas. Records are saved into store once spiders are closed, so it should be
+// registered as a pipeline even if no item needs to be marked.
+//
+// For example:
+/*
+store, _ := incremental.NewFileStore("./state/incremental.json")
+inc := incremental.New(incremental.Config{
+	Store:    store,
+	Matcher:  goscrapy.NewRegexpMatcher(`/product/\d+`),
+	ItemList: []string{"product"},
+})
+
+engine := goscrapy.New(inc.Option())
+engine.RegisterPipelines(inc, &ProductPipeline{})
+*/
+type Incremental struct {
+	cfg Config
+}
+
+// New creates incremental.
+func New(cfg Config) *Incremental {
+	if cfg.KeyField == "" {
+		cfg.KeyField = "url"
+	}
+
+	if cfg.StatusField == "" {
+		cfg.StatusField = "_status"
+	}
+
+	return &Incremental{cfg: cfg}
+}
+
+// Option returns an engine option registering request and response middlewares.
+func (inc *Incremental) Option() goscrapy.Option {
+	return func(e *goscrapy.Engine) {
+		goscrapy.WithRequestMiddlewares(inc.ProcessRequest)(e)
+		goscrapy.WithResponseMiddlewares(inc.ProcessResponse)(e)
+	}
+}
+
+// ProcessRequest is a request middleware adding conditional headers from the previous crawl.
+func (inc *Incremental) ProcessRequest(req *goscrapy.Request) error {
+	if !inc.match(req) {
+		return nil
+	}
+
+	record, ok := inc.cfg.Store.Get(pageKey(req))
+	if !ok {
+		return nil
+	}
+
+	if record.ETag == "" && record.LastModified == "" {
+		return nil
+	}
+
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+
+	if record.ETag != "" {
+		req.Header.Set("If-None-Match", record.ETag)
+	}
+
+	if record.LastModified != "" {
+		req.Header.Set("If-Modified-Since", record.LastModified)
+	}
+
+	return nil
+}
+
+// ProcessResponse is a response middleware recording pages, responses of 304 or unchanged
+// bodies will not be parsed by spiders.
+func (inc *Incremental) ProcessResponse(resp *goscrapy.Response) error {
+	req := resp.Request
+	if req == nil || !inc.match(req) {
+		return nil
+	}
+
+	key := pageKey(req)
+	record, exists := inc.cfg.Store.Get(key)
+	if resp.StatusCode == http.StatusNotModified {
+		req.WithContextValue(ContextKeyStatus, StatusUnchanged)
+		req.Abort()
+		return nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil
+	}
+
+	hash := checksum(resp.Body)
+	if exists && record.Hash == hash {
+		req.WithContextValue(ContextKeyStatus, StatusUnchanged)
+		req.Abort()
+		return nil
+	}
+
+	status := StatusNew
+	if exists {
+		status = StatusChanged
+	}
+	req.WithContextValue(ContextKeyStatus, status)
+
+	record = &Record{
+		Hash:      hash,
+		UpdatedAt: time.Now(),
+	}
+
+	if resp.Header != nil {
+		record.ETag = resp.Header.Get("ETag")
+		record.LastModified = resp.Header.Get("Last-Modified")
+	}
+
+	inc.cfg.Store.Put(key, record)
+	return nil
+}
+
+// match returns true if request is crawled incrementally. Requests sent by pipelines
+// (e.g. downloading files) are excluded.
+func (inc *Incremental) match(req *goscrapy.Request) bool {
+	if req.SpiderName() == "" {
+		return false
+	}
+	return inc.cfg.Matcher == nil || inc.cfg.Matcher.Match(req.URL)
+}
+
+// Name returns pipeline's name
+func (inc *Incremental) Name() string {
+	return "incremental_pipeline"
+}
+
+// ItemList returns all items' name that this pipeline cares about
+func (inc *Incremental) ItemList() []string {
+	return inc.cfg.ItemList
+}
+
+// Handle marks items with status, unchanged items will be dropped if DropUnchanged is true.
+// Typed items keep their types, status is written back into the field tagged with StatusField
+// by engine (see goscrapy.ToItems).
+func (inc *Incremental) Handle(items *goscrapy.Items) error {
+	values := goscrapy.ItemToMap(items)
+	delete(values, inc.cfg.StatusField)
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	hash := checksum(data)
+
+	id := hash
+	if key, ok := values[inc.cfg.KeyField]; ok {
+		id = fmt.Sprint(key)
+	}
+
+	key := "item:" + items.ItemName() + ":" + id
+	status := StatusNew
+	if record, ok := inc.cfg.Store.Get(key); ok {
+		status = StatusChanged
+		if record.Hash == hash {
+			status = StatusUnchanged
+		}
+	}
+
+	if status == StatusUnchanged && inc.cfg.DropUnchanged {
+		return goscrapy.DropItem("unchanged")
+	}
+
+	if status != StatusUnchanged {
+		inc.cfg.Store.Put(key, &Record{Hash: hash, UpdatedAt: time.Now()})
+	}
+
+	items.Store(inc.cfg.StatusField, status)
+	return nil
+}
+
+// Close saves records into store, it's called by engine once spider has been closed.
+func (inc *Incremental) Close(ctx context.Context, spider goscrapy.Spider) error {
+	return inc.cfg.Store.Save()
+}
+
+// pageKey returns the key of page requested by req, Request.Query is encoded into the url the
+// same way as downloader does, so that requests differing only in query are different pages.
+func pageKey(req *goscrapy.Request) string {
+	rawURL := req.URL
+	if len(req.Query) > 0 {
+		if u, err := url.Parse(req.URL); err == nil {
+			u.RawQuery = req.Query.Encode()
+			rawURL = u.String()
+		}
+	}
+
+	return "page:" + rawURL
+}
+
+func checksum(data []byte) string {
+	hash := sha1.Sum(data)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,88 @@
+package incremental
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jiandahao/goscrapy/internal/fsutil"
+)
+
+// Record records the state of a page or an item from previous crawls.
+type Record struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Hash         string    `json:"hash,omitempty"` // sha1 of page body or item content
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Store persists records across crawls.
+type Store interface {
+	Get(key string) (*Record, bool)
+	Put(key string, record *Record)
+	Save() error // persists records
+}
+
+var _ Store = &FileStore{}
+
+// FileStore keeps records in memory and persists them into a JSON file.
+type FileStore struct {
+	path    string
+	records map[string]*Record
+	mux     sync.RWMutex
+}
+
+// NewFileStore creates a file store, records saved by previous crawls will be loaded from path.
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{
+		path:    path,
+		records: make(map[string]*Record),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fs, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &fs.records); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// Get returns the record of key.
+func (fs *FileStore) Get(key string) (*Record, bool) {
+	fs.mux.RLock()
+	defer fs.mux.RUnlock()
+
+	record, ok := fs.records[key]
+	return record, ok
+}
+
+// Put sets the record of key.
+func (fs *FileStore) Put(key string, record *Record) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	fs.records[key] = record
+}
+
+// Save writes all records into file.
+func (fs *FileStore) Save() error {
+	fs.mux.RLock()
+	data, err := json.Marshal(fs.records)
+	fs.mux.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(fs.path, data, 0644)
+}
@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jiandahao/goscrapy"
+)
+
+var _ goscrapy.Pipeline = &ArtifactPipeline{}
+
+// ArtifactConfig artifact pipeline config
+type ArtifactConfig struct {
+	// Dir is the root directory to store artifacts.
+	Dir string
+	// ItemList are names of items that this pipeline cares about.
+	ItemList []string
+	// ArtifactsField is the item key holding artifacts ([]*goscrapy.Artifact), "artifacts" by default.
+	ArtifactsField string
+	// KeyField is the item key holding the value identifying item (e.g. page url), which
+	// is used to generate storage path. "url" by default.
+	KeyField string
+	// PathsField is the item key that stored paths ([]string) will be written back to,
+	// "artifact_paths" by default.
+	PathsField string
+}
+
+// ArtifactPipeline stores artifacts (e.g. screenshots) attached to items into disk. Artifacts
+// are stored under a deterministic path {Dir}/{item name}/{sha1 of key}/{artifact name}, so that
+// artifacts of the same item will always be stored into the same directory.
+//
+// For example:
+/*
+func (s *Spider) Parse(ctx *goscrapy.Context) (*goscrapy.Items, []*goscrapy.Request, error) {
+	items := goscrapy.NewItems("product")
+	items.Store("url", ctx.Request().URL)
+	items.Store("artifacts", ctx.Response().Artifacts)
+	return items, nil, nil
+}
+*/
+type ArtifactPipeline struct {
+	cfg ArtifactConfig
+}
+
+// NewArtifactPipeline creates an artifact pipeline.
+func NewArtifactPipeline(cfg ArtifactConfig) *ArtifactPipeline {
+	if cfg.ArtifactsField == "" {
+		cfg.ArtifactsField = "artifacts"
+	}
+
+	if cfg.KeyField == "" {
+		cfg.KeyField = "url"
+	}
+
+	if cfg.PathsField == "" {
+		cfg.PathsField = "artifact_paths"
+	}
+
+	return &ArtifactPipeline{cfg: cfg}
+}
+
+// Name returns pipeline's name
+func (ap *ArtifactPipeline) Name() string {
+	return "artifact_pipeline"
+}
+
+// ItemList returns all items' name that this pipeline cares about
+func (ap *ArtifactPipeline) ItemList() []string {
+	return ap.cfg.ItemList
+}
+
+// Handle stores artifacts of items and writes stored paths back into items.
+func (ap *ArtifactPipeline) Handle(items *goscrapy.Items) error {
+	val, ok := items.Load(ap.cfg.ArtifactsField)
+	if !ok {
+		return nil
+	}
+
+	artifacts, ok := val.([]*goscrapy.Artifact)
+	if !ok {
+		return fmt.Errorf("invalid artifacts type %T", val)
+	}
+
+	if len(artifacts) <= 0 {
+		return nil
+	}
+
+	key, ok := items.Load(ap.cfg.KeyField)
+	if !ok {
+		return fmt.Errorf("missing item key field: %s", ap.cfg.KeyField)
+	}
+
+	dir := ap.artifactDir(items.Name(), fmt.Sprint(key))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, artifact := range artifacts {
+		if artifact == nil {
+			continue
+		}
+
+		path := filepath.Join(dir, filepath.Base(artifact.Name))
+		if err := ioutil.WriteFile(path, artifact.Data, 0644); err != nil {
+			return err
+		}
+
+		paths = append(paths, path)
+	}
+
+	items.Store(ap.cfg.PathsField, paths)
+	return nil
+}
+
+func (ap *ArtifactPipeline) artifactDir(itemName string, key string) string {
+	hash := sha1.Sum([]byte(key))
+	return filepath.Join(ap.cfg.Dir, itemName, hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,418 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jiandahao/goscrapy"
+	"github.com/jiandahao/goscrapy/internal/fsutil"
+	"github.com/jiandahao/goutils/logger"
+)
+
+var _ goscrapy.Pipeline = &FilesPipeline{}
+var _ goscrapy.DownloaderAware = &FilesPipeline{}
+
+// Layout builds the path (relative to the root directory) of file by its checksum and extension.
+type Layout func(checksum string, ext string) string
+
+// FlatLayout stores files in the root directory, e.g. {checksum}.jpg
+func FlatLayout(checksum string, ext string) string {
+	return checksum + ext
+}
+
+// NestedLayout stores files into sub directories named by the first four characters of
+// checksum, e.g. ab/cd/{checksum}.jpg, so that there won't be too many files in one directory.
+func NestedLayout(checksum string, ext string) string {
+	return filepath.Join(checksum[:2], checksum[2:4], checksum+ext)
+}
+
+// FilesConfig files pipeline config
+type FilesConfig struct {
+	// Dir is the root directory to store files.
+	Dir string
+	// ItemList are names of items that this pipeline cares about.
+	ItemList []string
+	// URLsField is the item key holding absolute urls of files (string or []string), "file_urls"
+	// by default.
+	URLsField string
+	// ResultsField is the item key that downloaded files ([]*File) will be written back to,
+	// "files" by default.
+	ResultsField string
+	// Expires is the duration that downloaded files are considered fresh, files downloaded
+	// within Expires will not be downloaded again. 90 days by default, files never expire
+	// if negative.
+	Expires time.Duration
+	// Layout builds storage path of files, NestedLayout by default.
+	Layout Layout
+	// Header is the header of download requests.
+	Header http.Header
+}
+
+// File represents a file downloaded by pipeline.
+type File struct {
+	URL          string    `json:"url"`
+	Path         string    `json:"path"`     // path relative to the root directory
+	Checksum     string    `json:"checksum"` // sha1 of file content
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+	// fields of images, see ImagesPipeline
+	Width  int               `json:"width,omitempty"`
+	Height int               `json:"height,omitempty"`
+	Thumbs map[string]string `json:"thumbs,omitempty"` // maps thumbnail name to path
+}
+
+// errFileSkipped is returned when storing file if file is filtered out, e.g. image is
+// too small. Skipped urls will not be downloaded again during crawling.
+var errFileSkipped = errors.New("file skipped")
+
+// FilesPipeline downloads files (e.g. PDFs) referenced by items. Downloads are sent through
+// engine (see goscrapy.DownloaderAware) so that they go through middlewares and respect delay
+// of engine. Files are stored by sha1 of content, so that the same content is stored only once
+// even if referenced by different urls. Urls downloaded within the expiry window will not be
+// downloaded again, and the same url referenced by concurrent items is downloaded only once.
+// Urls of files must be absolute, spiders should resolve hrefs against url of pages.
+//
+// For example:
+/*
+func (s *Spider) Parse(ctx *goscrapy.Context) (*goscrapy.Items, []*goscrapy.Request, error) {
+	hrefs, err := ctx.Response().XPathStrings("//a[@class='pdf']/@href")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	base, err := url.Parse(ctx.Request().URL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var urls []string
+	for _, href := range hrefs {
+		if u, err := base.Parse(href); err == nil {
+			urls = append(urls, u.String())
+		}
+	}
+
+	items := goscrapy.NewItems("report")
+	items.Store("file_urls", urls)
+	return items, nil, nil
+}
+*/
+type FilesPipeline struct {
+	cfg        FilesConfig
+	downloader goscrapy.Downloader
+	lg         logger.Logger
+	// store persists the downloaded content, it allows pipelines built on top of files
+	// pipeline (e.g. images pipeline) to customize storing.
+	store    func(rawURL string, resp *goscrapy.Response) (*File, error)
+	inflight map[string]*fileCall
+	skipped  map[string]struct{} // urls skipped during crawling, see errFileSkipped
+	mux      sync.Mutex
+}
+
+// maxSkippedURLs is the maximum number of skipped urls remembered by pipeline.
+const maxSkippedURLs = 10000
+
+// fileCall represents an in-flight download.
+type fileCall struct {
+	wg   sync.WaitGroup
+	file *File
+	err  error
+}
+
+// NewFilesPipeline creates a files pipeline.
+func NewFilesPipeline(cfg FilesConfig) *FilesPipeline {
+	if cfg.URLsField == "" {
+		cfg.URLsField = "file_urls"
+	}
+
+	if cfg.ResultsField == "" {
+		cfg.ResultsField = "files"
+	}
+
+	if cfg.Expires == 0 {
+		cfg.Expires = 90 * 24 * time.Hour
+	}
+
+	if cfg.Layout == nil {
+		cfg.Layout = NestedLayout
+	}
+
+	fp := &FilesPipeline{
+		cfg:        cfg,
+		downloader: &goscrapy.DefaultDownloader{},
+		lg:         logger.NewDefaultLogger("info"),
+		inflight:   make(map[string]*fileCall),
+		skipped:    make(map[string]struct{}),
+	}
+	fp.store = fp.storeFile
+
+	return fp
+}
+
+// Name returns pipeline's name
+func (fp *FilesPipeline) Name() string {
+	return "files_pipeline"
+}
+
+// ItemList returns all items' name that this pipeline cares about
+func (fp *FilesPipeline) ItemList() []string {
+	return fp.cfg.ItemList
+}
+
+// SetDownloader sets the downloader used to download files, it's called by engine
+// when registering pipelines.
+func (fp *FilesPipeline) SetDownloader(d goscrapy.Downloader) {
+	fp.downloader = d
+}
+
+// SetLogger sets the logger, it's called by engine when registering pipelines.
+func (fp *FilesPipeline) SetLogger(lg logger.Logger) {
+	fp.lg = lg
+}
+
+// Handle downloads files of items and writes downloaded files back into items. Typed items
+// keep their types, files are written back into the field tagged with ResultsField by engine
+// (see goscrapy.ToItems).
+func (fp *FilesPipeline) Handle(items *goscrapy.Items) error {
+	val, ok := items.Load(fp.cfg.URLsField)
+	if !ok {
+		return nil
+	}
+
+	urls, err := toStrings(val)
+	if err != nil {
+		return err
+	}
+
+	var files []*File
+	for _, rawURL := range urls {
+		if rawURL == "" {
+			continue
+		}
+
+		if u, err := url.Parse(rawURL); err != nil || !u.IsAbs() {
+			fp.lg.Errorf(context.Background(), "invalid file url %s: url must be absolute", rawURL)
+			continue
+		}
+
+		file, err := fp.fetch(rawURL)
+		if errors.Is(err, errFileSkipped) {
+			continue
+		}
+
+		if err != nil {
+			fp.lg.Errorf(context.Background(), "failed to download file %s: %v", rawURL, err)
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	items.Store(fp.cfg.ResultsField, files)
+	return nil
+}
+
+// fetch returns the file of url, the file will be downloaded if it has not been
+// downloaded or has expired. Downloaded files are looked up from disk, so that expiry
+// is checked every time.
+func (fp *FilesPipeline) fetch(rawURL string) (*File, error) {
+	fp.mux.Lock()
+	if _, ok := fp.skipped[rawURL]; ok {
+		fp.mux.Unlock()
+		return nil, errFileSkipped
+	}
+
+	if call, ok := fp.inflight[rawURL]; ok {
+		fp.mux.Unlock()
+		call.wg.Wait()
+		return call.file, call.err
+	}
+
+	call := &fileCall{}
+	call.wg.Add(1)
+	fp.inflight[rawURL] = call
+	fp.mux.Unlock()
+
+	call.file, call.err = fp.download(rawURL)
+	call.wg.Done()
+
+	fp.mux.Lock()
+	delete(fp.inflight, rawURL)
+	if errors.Is(call.err, errFileSkipped) {
+		// evicting an arbitrary url to keep the set bounded
+		if len(fp.skipped) >= maxSkippedURLs {
+			for u := range fp.skipped {
+				delete(fp.skipped, u)
+				break
+			}
+		}
+		fp.skipped[rawURL] = struct{}{}
+	}
+	fp.mux.Unlock()
+
+	return call.file, call.err
+}
+
+func (fp *FilesPipeline) download(rawURL string) (*File, error) {
+	if file, ok := fp.lookup(rawURL); ok {
+		return file, nil
+	}
+
+	req := &goscrapy.Request{
+		Method: http.MethodGet,
+		URL:    rawURL,
+	}
+
+	if fp.cfg.Header != nil {
+		req.Header = fp.cfg.Header.Clone()
+	}
+
+	resp, err := fp.downloader.Download(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 0 && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	file, err := fp.store(rawURL, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fp.saveIndex(file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// storeFile stores response body by its checksum.
+func (fp *FilesPipeline) storeFile(rawURL string, resp *goscrapy.Response) (*File, error) {
+	contentType := resp.Header.Get("Content-Type")
+	file := &File{
+		URL:          rawURL,
+		Size:         int64(len(resp.Body)),
+		ContentType:  contentType,
+		DownloadedAt: time.Now(),
+	}
+
+	file.Checksum = checksum(resp.Body)
+	file.Path = fp.cfg.Layout(file.Checksum, fileExt(rawURL, contentType))
+	if err := fp.writeFile(file.Path, resp.Body); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// writeFile writes data into path relative to the root directory, existing file will be
+// kept as it must have the same content.
+func (fp *FilesPipeline) writeFile(relPath string, data []byte) error {
+	fullPath := filepath.Join(fp.cfg.Dir, relPath)
+	if _, err := os.Stat(fullPath); err == nil {
+		return nil
+	}
+
+	return fsutil.WriteFileAtomic(fullPath, data, 0644)
+}
+
+// lookup returns the file of url downloaded within the expiry window.
+func (fp *FilesPipeline) lookup(rawURL string) (*File, bool) {
+	data, err := ioutil.ReadFile(fp.indexPath(rawURL))
+	if err != nil {
+		return nil, false
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil || file.URL != rawURL {
+		return nil, false
+	}
+
+	if fp.cfg.Expires > 0 && time.Since(file.DownloadedAt) > fp.cfg.Expires {
+		return nil, false
+	}
+
+	if _, err := os.Stat(filepath.Join(fp.cfg.Dir, file.Path)); err != nil {
+		return nil, false
+	}
+
+	return &file, true
+}
+
+// saveIndex records the downloaded file of url.
+func (fp *FilesPipeline) saveIndex(file *File) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(fp.indexPath(file.URL), data, 0644)
+}
+
+// indexPath returns the path of index file recording the downloaded file of url.
+func (fp *FilesPipeline) indexPath(rawURL string) string {
+	return filepath.Join(fp.cfg.Dir, "index", checksum([]byte(rawURL))+".json")
+}
+
+func checksum(data []byte) string {
+	hash := sha1.Sum(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// fileExt returns file extension from url path or content type.
+func fileExt(rawURL string, contentType string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		ext := strings.ToLower(path.Ext(u.Path))
+		if len(ext) > 1 && len(ext) <= 5 {
+			return ext
+		}
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+			return exts[0]
+		}
+	}
+
+	return ""
+}
+
+func toStrings(val interface{}) ([]string, error) {
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, s := range v {
+			str, ok := s.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid url type %T", s)
+			}
+			res = append(res, str)
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("invalid urls type %T", val)
+	}
+}
@@ -0,0 +1,269 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register gif decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/jiandahao/goscrapy"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register webp decoder
+)
+
+var _ goscrapy.Pipeline = &ImagesPipeline{}
+var _ goscrapy.DownloaderAware = &ImagesPipeline{}
+
+// ImageFormat represents the format that images are converted to.
+type ImageFormat string
+
+// all supported image formats
+const (
+	ImageJPEG ImageFormat = "jpeg"
+	ImagePNG  ImageFormat = "png"
+)
+
+// ThumbSize represents the box that thumbnails fit in, aspect ratio of images is kept
+// and images smaller than the box will not be enlarged.
+type ThumbSize struct {
+	Width  int
+	Height int
+}
+
+// ImagesConfig images pipeline config
+type ImagesConfig struct {
+	// Dir is the root directory to store images.
+	Dir string
+	// ItemList are names of items that this pipeline cares about.
+	ItemList []string
+	// URLsField is the item key holding absolute urls of images (string or []string), "image_urls"
+	// by default.
+	URLsField string
+	// ResultsField is the item key that downloaded images ([]*File) will be written back to,
+	// "images" by default.
+	ResultsField string
+	// Expires see FilesConfig.Expires
+	Expires time.Duration
+	// Layout builds storage path of images, NestedLayout by default.
+	Layout Layout
+	// Header is the header of download requests.
+	Header http.Header
+	// MinWidth and MinHeight are the minimum dimensions of images, smaller images are dropped.
+	MinWidth  int
+	MinHeight int
+	// MaxPixels is the maximum number of pixels (width * height) of images, larger images
+	// are dropped without being decoded, so that images declaring huge dimensions won't
+	// exhaust memory. 50 million by default.
+	MaxPixels int64
+	// Format is the format that images are converted to, ImageJPEG by default.
+	Format ImageFormat
+	// Quality is the quality of JPEG images ranging from 1 to 100, 85 by default.
+	Quality int
+	// Thumbs maps thumbnail names to their sizes. Thumbnails are stored under
+	// {Dir}/thumbs/{name}/ with the same layout of images.
+	Thumbs map[string]ThumbSize
+}
+
+// ImagesPipeline downloads images referenced by items on top of FilesPipeline. JPEG, PNG,
+// GIF and WebP images are decoded, images smaller than minimum dimensions or larger than MaxPixels
+// are dropped, and the others are converted into a normalized format with configured thumbnails generated. Downloaded
+// images with their dimensions are written back into items.
+//
+// For example:
+/*
+p := pipeline.NewImagesPipeline(pipeline.ImagesConfig{
+	Dir:       "./images",
+	ItemList:  []string{"product"},
+	MinWidth:  100,
+	MinHeight: 100,
+	Thumbs: map[string]pipeline.ThumbSize{
+		"small": {Width: 50, Height: 50},
+		"big":   {Width: 270, Height: 270},
+	},
+})
+*/
+type ImagesPipeline struct {
+	*FilesPipeline
+	cfg ImagesConfig
+}
+
+// NewImagesPipeline creates an images pipeline.
+func NewImagesPipeline(cfg ImagesConfig) *ImagesPipeline {
+	if cfg.URLsField == "" {
+		cfg.URLsField = "image_urls"
+	}
+
+	if cfg.ResultsField == "" {
+		cfg.ResultsField = "images"
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = ImageJPEG
+	}
+
+	if cfg.Quality <= 0 || cfg.Quality > 100 {
+		cfg.Quality = 85
+	}
+
+	if cfg.MaxPixels <= 0 {
+		cfg.MaxPixels = 50000000
+	}
+
+	ip := &ImagesPipeline{
+		FilesPipeline: NewFilesPipeline(FilesConfig{
+			Dir:          cfg.Dir,
+			ItemList:     cfg.ItemList,
+			URLsField:    cfg.URLsField,
+			ResultsField: cfg.ResultsField,
+			Expires:      cfg.Expires,
+			Layout:       cfg.Layout,
+			Header:       cfg.Header,
+		}),
+	}
+	ip.cfg = cfg
+	ip.cfg.Layout = ip.FilesPipeline.cfg.Layout
+	ip.FilesPipeline.store = ip.storeImage
+
+	return ip
+}
+
+// Name returns pipeline's name
+func (ip *ImagesPipeline) Name() string {
+	return "images_pipeline"
+}
+
+// storeImage converts image into the normalized format and generates thumbnails.
+func (ip *ImagesPipeline) storeImage(rawURL string, resp *goscrapy.Response) (*File, error) {
+	// checking dimensions declared by header before decoding the whole image
+	config, _, err := image.DecodeConfig(bytes.NewReader(resp.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	if int64(config.Width)*int64(config.Height) > ip.cfg.MaxPixels {
+		return nil, fmt.Errorf("%w: image too large (%dx%d)", errFileSkipped, config.Width, config.Height)
+	}
+
+	if config.Width < ip.cfg.MinWidth || config.Height < ip.cfg.MinHeight {
+		return nil, fmt.Errorf("%w: image too small (%dx%d)", errFileSkipped, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(resp.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	bounds := img.Bounds()
+
+	data, err := ip.encode(img)
+	if err != nil {
+		return nil, err
+	}
+
+	ext, contentType := ip.formatExt()
+	file := &File{
+		URL:          rawURL,
+		Checksum:     checksum(resp.Body),
+		Size:         int64(len(data)),
+		ContentType:  contentType,
+		DownloadedAt: time.Now(),
+		Width:        bounds.Dx(),
+		Height:       bounds.Dy(),
+	}
+
+	file.Path = ip.cfg.Layout(file.Checksum, ext)
+	if err := ip.writeFile(file.Path, data); err != nil {
+		return nil, err
+	}
+
+	for name, size := range ip.cfg.Thumbs {
+		thumb, err := ip.encode(thumbnail(img, size))
+		if err != nil {
+			return nil, err
+		}
+
+		thumbPath := filepath.Join("thumbs", name, file.Path)
+		if err := ip.writeFile(thumbPath, thumb); err != nil {
+			return nil, err
+		}
+
+		if file.Thumbs == nil {
+			file.Thumbs = make(map[string]string)
+		}
+		file.Thumbs[name] = thumbPath
+	}
+
+	return file, nil
+}
+
+// encode encodes image in the normalized format.
+func (ip *ImagesPipeline) encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	switch ip.cfg.Format {
+	case ImagePNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case ImageJPEG:
+		// jpeg does not support transparency, filling transparent pixels with white
+		bounds := img.Bounds()
+		rgba := image.NewRGBA(bounds)
+		draw.Draw(rgba, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(rgba, bounds, img, bounds.Min, draw.Over)
+
+		if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: ip.cfg.Quality}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported image format: %s", ip.cfg.Format)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (ip *ImagesPipeline) formatExt() (ext string, contentType string) {
+	if ip.cfg.Format == ImagePNG {
+		return ".png", "image/png"
+	}
+	return ".jpg", "image/jpeg"
+}
+
+// thumbnail scales image down to fit in size.
+func thumbnail(img image.Image, size ThumbSize) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	scale := 1.0
+	if size.Width > 0 && width > size.Width {
+		scale = float64(size.Width) / float64(width)
+	}
+
+	if size.Height > 0 && height > size.Height {
+		if s := float64(size.Height) / float64(height); s < scale {
+			scale = s
+		}
+	}
+
+	if scale >= 1 {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, maxInt(1, int(float64(width)*scale)), maxInt(1, int(float64(height)*scale))))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,446 @@
+// Package sqlite implements a pipeline storing items into SQLite database.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jiandahao/goscrapy"
+	"github.com/jiandahao/goutils/logger"
+	_ "github.com/mattn/go-sqlite3" // sqlite driver
+)
+
+// Config sqlite pipeline config
+type Config struct {
+	// Path is the path of database file.
+	Path string
+	// ItemList are names of items that this pipeline cares about.
+	ItemList []string
+	// BatchSize is the number of items inserted in one transaction, 100 by default.
+	BatchSize int
+	// UniqueKeys maps item name to columns identifying item. Items with the same
+	// unique key will be updated instead of inserted.
+	UniqueKeys map[string][]string
+}
+
+var _ goscrapy.Pipeline = &Pipeline{}
+var _ goscrapy.ItemPipeline = &Pipeline{}
+var _ goscrapy.PipelineOpener = &Pipeline{}
+var _ goscrapy.PipelineCloser = &Pipeline{}
+var _ goscrapy.LoggerAware = &Pipeline{}
+
+// Pipeline stores items into SQLite tables named by item name. Tables and columns
+// are created from keys of items automatically, items are inserted in batches and
+// flushed once crawling finished. If a batch fails, items are inserted one by one
+// and those failing (e.g. with keys differing only in case, which are the same
+// column in SQLite) are dropped.
+type Pipeline struct {
+	cfg    Config
+	lg     logger.Logger
+	db     *sql.DB
+	tables map[string]*table
+	mux    sync.Mutex
+	refs   int // number of spiders opened the pipeline
+}
+
+type table struct {
+	name    string
+	columns map[string]struct{}
+	unique  []string
+	indexed bool // true if unique index has been created
+	rows    []map[string]interface{}
+}
+
+// NewPipeline creates a sqlite pipeline.
+func NewPipeline(cfg Config) *Pipeline {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+
+	return &Pipeline{
+		cfg:    cfg,
+		lg:     logger.NewDefaultLogger("info"),
+		tables: make(map[string]*table),
+	}
+}
+
+// Name returns pipeline's name
+func (p *Pipeline) Name() string {
+	return "sqlite_pipeline"
+}
+
+// ItemList returns all items' name that this pipeline cares about
+func (p *Pipeline) ItemList() []string {
+	return p.cfg.ItemList
+}
+
+// SetLogger sets the logger, it's called by engine when registering pipelines.
+func (p *Pipeline) SetLogger(lg logger.Logger) {
+	p.lg = lg
+}
+
+// Open opens database, it's called by engine before crawling.
+func (p *Pipeline) Open(ctx context.Context, spider goscrapy.Spider) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.refs++
+	if p.db != nil {
+		return nil
+	}
+
+	db, err := sql.Open("sqlite3", p.cfg.Path)
+	if err != nil {
+		p.refs--
+		return err
+	}
+
+	// sqlite does not support concurrent writing
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		p.refs--
+		return err
+	}
+
+	p.db = db
+	return nil
+}
+
+// Close flushes pending items and closes database once all spiders have been closed.
+func (p *Pipeline) Close(ctx context.Context, spider goscrapy.Spider) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.db == nil {
+		return nil
+	}
+
+	var err error
+	for _, t := range p.tables {
+		if e := p.flush(t); e != nil {
+			err = e
+		}
+	}
+
+	p.refs--
+	if p.refs > 0 {
+		return err
+	}
+
+	if e := p.db.Close(); e != nil {
+		err = e
+	}
+	p.db = nil
+	p.tables = make(map[string]*table)
+
+	return err
+}
+
+// Handle stores items
+func (p *Pipeline) Handle(items *goscrapy.Items) error {
+	return p.HandleItem(items)
+}
+
+// HandleItem stores item, item will be written once the batch is full.
+func (p *Pipeline) HandleItem(item goscrapy.Item) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.db == nil {
+		return fmt.Errorf("database is not opened")
+	}
+
+	t, err := p.getTable(item.ItemName())
+	if err != nil {
+		return err
+	}
+
+	row := make(map[string]interface{})
+	for key, val := range goscrapy.ItemToMap(item) {
+		row[key] = toSQLValue(val)
+	}
+
+	t.rows = append(t.rows, row)
+	if len(t.rows) >= p.cfg.BatchSize {
+		return p.flush(t)
+	}
+
+	return nil
+}
+
+func (p *Pipeline) getTable(name string) (*table, error) {
+	if t, ok := p.tables[name]; ok {
+		return t, nil
+	}
+
+	t := &table{
+		name:    name,
+		columns: make(map[string]struct{}),
+		unique:  p.cfg.UniqueKeys[name],
+	}
+
+	rows, err := p.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", quote(name)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			column    string
+			typ       string
+			notNull   int
+			dfltValue interface{}
+			pk        int
+		)
+		if err := rows.Scan(&cid, &column, &typ, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		t.columns[column] = struct{}{}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	p.tables[name] = t
+	return t, nil
+}
+
+// flush writes all pending rows of table, tables and columns will be created if not exists.
+// Rows are written one by one if failed to write in a batch, rows still failing are dropped,
+// so that one bad row won't fail all the following flushes.
+func (p *Pipeline) flush(t *table) error {
+	if len(t.rows) == 0 {
+		return nil
+	}
+
+	rows := t.rows
+	t.rows = nil
+	if err := p.write(t, rows); err == nil {
+		return nil
+	}
+
+	var (
+		dropped int
+		err     error
+	)
+	for _, row := range rows {
+		if e := p.write(t, []map[string]interface{}{row}); e != nil {
+			p.lg.Errorf(context.Background(), "failed to write row into table %s, dropped: %v", t.name, e)
+			dropped++
+			err = e
+		}
+	}
+
+	if dropped > 0 {
+		return fmt.Errorf("%d rows dropped from table %s: %w", dropped, t.name, err)
+	}
+
+	return nil
+}
+
+// write writes rows into table in a transaction.
+func (p *Pipeline) write(t *table, rows []map[string]interface{}) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	columns, indexed, err := p.migrate(tx, t, rows)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, row := range rows {
+		if err := p.insert(tx, t, row); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// caching schema only after committed, it's rolled back otherwise
+	for _, column := range columns {
+		t.columns[column] = struct{}{}
+	}
+	t.indexed = t.indexed || indexed
+
+	return nil
+}
+
+// migrate creates table and columns observed in rows, it returns the created
+// columns and whether the unique index has been created.
+func (p *Pipeline) migrate(tx *sql.Tx, t *table, rows []map[string]interface{}) ([]string, bool, error) {
+	types := make(map[string]string)
+	for _, row := range rows {
+		for key, val := range row {
+			if _, ok := t.columns[key]; ok {
+				continue
+			}
+			if _, ok := types[key]; !ok || val != nil {
+				types[key] = columnType(val)
+			}
+		}
+	}
+
+	// unique key columns must exist before creating unique index
+	for _, key := range t.unique {
+		if _, ok := t.columns[key]; !ok {
+			if _, ok := types[key]; !ok {
+				types[key] = "TEXT"
+			}
+		}
+	}
+
+	if len(types) == 0 {
+		indexed, err := p.createUniqueIndex(tx, t)
+		return nil, indexed, err
+	}
+
+	columns := make([]string, 0, len(types))
+	for column := range types {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	if len(t.columns) == 0 {
+		defs := make([]string, 0, len(columns))
+		for _, column := range columns {
+			defs = append(defs, fmt.Sprintf("%s %s", quote(column), types[column]))
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quote(t.name), strings.Join(defs, ", "))); err != nil {
+			return nil, false, err
+		}
+	} else {
+		for _, column := range columns {
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quote(t.name), quote(column), types[column])); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	indexed, err := p.createUniqueIndex(tx, t)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return columns, indexed, nil
+}
+
+// createUniqueIndex creates the unique index if not created yet, it returns true if created.
+func (p *Pipeline) createUniqueIndex(tx *sql.Tx, t *table) (bool, error) {
+	if len(t.unique) == 0 || t.indexed {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)",
+		quote("uniq_"+t.name), quote(t.name), quoteAll(t.unique))); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (p *Pipeline) insert(tx *sql.Tx, t *table, row map[string]interface{}) error {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	placeholders := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for index, column := range columns {
+		placeholders[index] = "?"
+		args[index] = row[column]
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quote(t.name), quoteAll(columns), strings.Join(placeholders, ", "))
+	if len(t.unique) > 0 {
+		var updates []string
+		for _, column := range columns {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", quote(column), quote(column)))
+		}
+		query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", quoteAll(t.unique), strings.Join(updates, ", "))
+	}
+
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// toSQLValue converts value into types supported by sqlite driver, non-scalar
+// values are stored as JSON.
+func toSQLValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil, string, []byte, bool, int, int8, int16, int32, int64, uint8, uint16, uint32, float32, float64:
+		return v
+	case uint:
+		return toSQLValue(uint64(v))
+	case uint64:
+		// sqlite integers are signed, storing larger values as text
+		if v > math.MaxInt64 {
+			return strconv.FormatUint(v, 10)
+		}
+		return int64(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(val)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		return toSQLValue(rv.Elem().Interface())
+	}
+
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprint(val)
+	}
+	return string(data)
+}
+
+func columnType(val interface{}) string {
+	switch val.(type) {
+	case bool, int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return "INTEGER"
+	case float32, float64:
+		return "REAL"
+	case []byte:
+		return "BLOB"
+	default:
+		return "TEXT"
+	}
+}
+
+func quote(identifier string) string {
+	return `"` + strings.Replace(identifier, `"`, `""`, -1) + `"`
+}
+
+func quoteAll(identifiers []string) string {
+	res := make([]string, len(identifiers))
+	for index, identifier := range identifiers {
+		res[index] = quote(identifier)
+	}
+	return strings.Join(res, ", ")
+}
@@ -0,0 +1,215 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jiandahao/goscrapy"
+)
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+func TestToSQLValue(t *testing.T) {
+	str := "pointer"
+	var nilPtr *string
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	cases := []struct {
+		name string
+		in   interface{}
+		want interface{}
+	}{
+		{name: "nil", in: nil, want: nil},
+		{name: "string", in: "a", want: "a"},
+		{name: "int", in: 1, want: 1},
+		{name: "bool", in: true, want: true},
+		{name: "float", in: 1.5, want: 1.5},
+		{name: "uint", in: uint(7), want: int64(7)},
+		{name: "small uint64", in: uint64(7), want: int64(7)},
+		{name: "max int64", in: uint64(math.MaxInt64), want: int64(math.MaxInt64)},
+		{name: "overflowed uint64", in: uint64(math.MaxUint64), want: "18446744073709551615"},
+		{name: "time", in: now, want: "2026-01-02T03:04:05.000000006Z"},
+		{name: "stringer", in: stringer{}, want: "stringer"},
+		{name: "pointer", in: &str, want: "pointer"},
+		{name: "nil pointer", in: nilPtr, want: nil},
+		{name: "slice", in: []string{"a", "b"}, want: `["a","b"]`},
+		{name: "map", in: map[string]int{"a": 1}, want: `{"a":1}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := toSQLValue(c.in); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("toSQLValue(%v) = %#v, want %#v", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func openPipeline(t *testing.T, cfg Config) *Pipeline {
+	t.Helper()
+
+	p := NewPipeline(cfg)
+	if err := p.Open(context.Background(), nil); err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+
+	return p
+}
+
+func handle(t *testing.T, p *Pipeline, name string, fields map[string]interface{}) error {
+	t.Helper()
+
+	items := goscrapy.NewItems(name)
+	for key, val := range fields {
+		items.Store(key, val)
+	}
+
+	return p.Handle(items)
+}
+
+func queryRows(t *testing.T, path string, query string) [][]interface{} {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("query %q error: %v", query, err)
+	}
+	defer rows.Close()
+
+	columns, _ := rows.Columns()
+	var res [][]interface{}
+	for rows.Next() {
+		vals := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, vals)
+	}
+
+	return res
+}
+
+func TestPipeline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.db")
+	p := openPipeline(t, Config{
+		Path:       path,
+		BatchSize:  2,
+		UniqueKeys: map[string][]string{"book": {"url"}},
+	})
+
+	for _, fields := range []map[string]interface{}{
+		{"url": "http://a.com/1", "title": "first", "price": 1.5},
+		{"url": "http://a.com/2", "title": "second"},
+		// new column added by later batch
+		{"url": "http://a.com/3", "title": "third", "stock": 3, "tags": []string{"go"}},
+		// updated by unique key
+		{"url": "http://a.com/1", "title": "first updated", "price": 2.5},
+		{"url": "http://a.com/4", "title": "big", "views": uint64(math.MaxUint64)},
+	} {
+		if err := handle(t, p, "book", fields); err != nil {
+			t.Fatalf("Handle error: %v", err)
+		}
+	}
+
+	if err := p.Close(context.Background(), nil); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	got := queryRows(t, path, `SELECT url, title, price, stock, tags, views FROM book ORDER BY url`)
+	want := [][]interface{}{
+		{"http://a.com/1", "first updated", 2.5, nil, nil, nil},
+		{"http://a.com/2", "second", nil, nil, nil, nil},
+		{"http://a.com/3", "third", nil, int64(3), `["go"]`, nil},
+		{"http://a.com/4", "big", nil, nil, nil, "18446744073709551615"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows %v, want %v", got, want)
+	}
+}
+
+func TestPipelineBadRow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.db")
+	p := openPipeline(t, Config{Path: path, BatchSize: 3})
+
+	// columns are case insensitive in sqlite, the second row fails to be inserted
+	err := handle(t, p, "page", map[string]interface{}{"url": "http://a.com/1"})
+	if err == nil {
+		err = handle(t, p, "page", map[string]interface{}{"url": "http://a.com/2", "URL": "http://a.com/2"})
+	}
+	if err == nil {
+		err = handle(t, p, "page", map[string]interface{}{"url": "http://a.com/3"})
+	}
+
+	if err == nil {
+		t.Fatalf("Handle succeeded, want error of the dropped row")
+	}
+
+	// following batches are not affected by the dropped row
+	for _, u := range []string{"http://a.com/4", "http://a.com/5"} {
+		if err := handle(t, p, "page", map[string]interface{}{"url": u}); err != nil {
+			t.Fatalf("Handle error: %v", err)
+		}
+	}
+
+	if err := p.Close(context.Background(), nil); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	got := queryRows(t, path, `SELECT url FROM page ORDER BY url`)
+	want := [][]interface{}{{"http://a.com/1"}, {"http://a.com/3"}, {"http://a.com/4"}, {"http://a.com/5"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows %v, want %v", got, want)
+	}
+}
+
+func TestPipelineNotOpened(t *testing.T) {
+	p := NewPipeline(Config{Path: filepath.Join(t.TempDir(), "items.db")})
+	if err := handle(t, p, "page", map[string]interface{}{"url": "http://a.com/1"}); err == nil {
+		t.Errorf("Handle succeeded before opened, want error")
+	}
+}
+
+func TestPipelineReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.db")
+
+	for i, u := range []string{"http://a.com/1", "http://a.com/2"} {
+		p := openPipeline(t, Config{Path: path})
+		fields := map[string]interface{}{"url": u}
+		if i > 0 {
+			fields["extra"] = "value"
+		}
+
+		if err := handle(t, p, "page", fields); err != nil {
+			t.Fatalf("Handle error: %v", err)
+		}
+
+		if err := p.Close(context.Background(), nil); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+	}
+
+	got := queryRows(t, path, `SELECT url, extra FROM page ORDER BY url`)
+	want := [][]interface{}{{"http://a.com/1", nil}, {"http://a.com/2", "value"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows %v, want %v", got, want)
+	}
+}
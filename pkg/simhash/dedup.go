@@ -0,0 +1,157 @@
+package simhash
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jiandahao/goscrapy"
+)
+
+// context keys of request set by Dedup, spiders could read them by Request.ContextValue.
+const (
+	ContextKeyFingerprint = "simhash_fingerprint"  // uint64 fingerprint of page
+	ContextKeyDuplicateOf = "simhash_duplicate_of" // url of the page that this page duplicates
+)
+
+// DedupConfig dedup config
+type DedupConfig struct {
+	// Index indexes fingerprints of pages, it's saved once spiders are closed.
+	Index *Index
+	// Matcher matches urls of pages to be checked, all pages are checked if nil.
+	Matcher goscrapy.URLMatcher
+	// MinTextLength is the minimum length of visible text, pages with shorter text
+	// (e.g. empty pages) are not checked. 1 by default.
+	MinTextLength int
+	// Skip skips parsing near-duplicate pages, otherwise pages are only tagged with
+	// ContextKeyDuplicateOf.
+	Skip bool
+	// ItemList are names of items that will be tagged.
+	ItemList []string
+	// KeyField is the item key holding url of page that item is scraped from, "url" by default.
+	KeyField string
+	// DuplicateField is the item key that url of the duplicated page will be written to,
+	// "_duplicate_of" by default.
+	DuplicateField string
+	// DropDuplicates drops items scraped from near-duplicate pages instead of tagging them.
+	DropDuplicates bool
+}
+
+var _ goscrapy.Pipeline = &Dedup{}
+var _ goscrapy.PipelineCloser = &Dedup{}
+
+// Dedup detects near-duplicate pages, e.g. the same content served under different urls
+// with session ids, tracking params or print views. SimHash fingerprints of visible text
+// are computed by response middleware, pages within the hamming distance of pages seen
+// before (including pages of previous runs) are tagged or skipped. As a pipeline, it tags
+// or drops items scraped from near-duplicate pages.
+//
+// For example:
+/*
+index, _ := simhash.NewIndex("./state/simhash.json", 3)
+dedup := simhash.NewDedup(simhash.DedupConfig{
+	Index:    index,
+	ItemList: []string{"article"},
+})
+
+engine := goscrapy.New(dedup.Option())
+engine.RegisterPipelines(dedup, &ArticlePipeline{})
+*/
+type Dedup struct {
+	cfg  DedupConfig
+	dups sync.Map // maps url of near-duplicate page to url of the duplicated page
+}
+
+// NewDedup creates dedup.
+func NewDedup(cfg DedupConfig) *Dedup {
+	if cfg.MinTextLength <= 0 {
+		cfg.MinTextLength = 1
+	}
+
+	if cfg.KeyField == "" {
+		cfg.KeyField = "url"
+	}
+
+	if cfg.DuplicateField == "" {
+		cfg.DuplicateField = "_duplicate_of"
+	}
+
+	return &Dedup{cfg: cfg}
+}
+
+// Option returns an engine option registering response middleware.
+func (d *Dedup) Option() goscrapy.Option {
+	return goscrapy.WithResponseMiddlewares(d.ProcessResponse)
+}
+
+// ProcessResponse is a response middleware computing fingerprint of page and finding
+// near-duplicates.
+func (d *Dedup) ProcessResponse(resp *goscrapy.Response) error {
+	req := resp.Request
+	if req == nil || req.SpiderName() == "" || resp.Document == nil {
+		return nil
+	}
+
+	if d.cfg.Matcher != nil && !d.cfg.Matcher.Match(req.URL) {
+		return nil
+	}
+
+	text := VisibleText(resp.Document)
+	if len(text) < d.cfg.MinTextLength {
+		return nil
+	}
+
+	fp := Fingerprint(text)
+	req.WithContextValue(ContextKeyFingerprint, fp)
+
+	dup, ok := d.cfg.Index.FindOrAdd(req.URL, fp)
+	if !ok {
+		return nil
+	}
+
+	req.WithContextValue(ContextKeyDuplicateOf, dup)
+	d.dups.Store(req.URL, dup)
+
+	if d.cfg.Skip {
+		req.Abort()
+	}
+
+	return nil
+}
+
+// Name returns pipeline's name
+func (d *Dedup) Name() string {
+	return "simhash_pipeline"
+}
+
+// ItemList returns all items' name that this pipeline cares about
+func (d *Dedup) ItemList() []string {
+	return d.cfg.ItemList
+}
+
+// Handle tags or drops items scraped from near-duplicate pages. Typed items keep their types,
+// the duplicate is written back into the field tagged with DuplicateField by engine (see
+// goscrapy.ToItems).
+func (d *Dedup) Handle(items *goscrapy.Items) error {
+	key, ok := items.Load(d.cfg.KeyField)
+	if !ok {
+		return nil
+	}
+
+	dup, ok := d.dups.Load(fmt.Sprint(key))
+	if !ok {
+		return nil
+	}
+
+	if d.cfg.DropDuplicates {
+		return goscrapy.DropItem(fmt.Sprintf("near-duplicate of %s", dup))
+	}
+
+	items.Store(d.cfg.DuplicateField, dup)
+	return nil
+}
+
+// Close saves index, it's called by engine once spider has been closed.
+func (d *Dedup) Close(ctx context.Context, spider goscrapy.Spider) error {
+	return d.cfg.Index.Save()
+}
@@ -0,0 +1,207 @@
+package simhash
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/jiandahao/goscrapy/internal/fsutil"
+)
+
+// Index indexes fingerprints of urls for finding near-duplicates within a hamming
+// distance. Fingerprints are split into distance+1 blocks, and by the pigeonhole principle
+// two fingerprints within the distance share at least one identical block, so only urls
+// sharing blocks are compared.
+type Index struct {
+	path     string
+	distance int
+	masks    []blockMask
+	urls     map[string]uint64                // maps url to its fingerprint
+	blocks   []map[uint64]map[string]struct{} // maps block value to urls for every block
+	mux      sync.RWMutex
+}
+
+type blockMask struct {
+	shift uint
+	mask  uint64
+}
+
+// NewIndex creates an index finding near-duplicates within distance, fingerprints saved
+// by previous runs will be loaded from path. Index is in memory only if path is empty.
+func NewIndex(path string, distance int) (*Index, error) {
+	if distance < 0 {
+		distance = 0
+	}
+
+	blockCount := distance + 1
+	if blockCount > 64 {
+		blockCount = 64
+	}
+
+	idx := &Index{
+		path:     path,
+		distance: distance,
+		urls:     make(map[string]uint64),
+		blocks:   make([]map[uint64]map[string]struct{}, blockCount),
+	}
+
+	// splitting 64 bits into blocks as evenly as possible
+	var shift uint
+	for i := 0; i < blockCount; i++ {
+		size := uint(64 / blockCount)
+		if i < 64%blockCount {
+			size++
+		}
+
+		mask := uint64(1)<<size - 1
+		if size == 64 {
+			mask = ^uint64(0)
+		}
+
+		idx.masks = append(idx.masks, blockMask{shift: shift, mask: mask})
+		idx.blocks[i] = make(map[uint64]map[string]struct{})
+		shift += size
+	}
+
+	if path == "" {
+		return idx, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var saved map[string]string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+
+	for url, val := range saved {
+		fp, err := strconv.ParseUint(val, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		idx.add(url, fp)
+	}
+
+	return idx, nil
+}
+
+// Find returns an url other than url whose fingerprint is within the distance of fp.
+func (idx *Index) Find(url string, fp uint64) (string, bool) {
+	idx.mux.RLock()
+	defer idx.mux.RUnlock()
+
+	return idx.find(url, fp)
+}
+
+func (idx *Index) find(url string, fp uint64) (string, bool) {
+	var (
+		found    string
+		distance = idx.distance + 1
+	)
+
+	for i, m := range idx.masks {
+		for candidate := range idx.blocks[i][(fp>>m.shift)&m.mask] {
+			if candidate == url {
+				continue
+			}
+
+			// choosing the closest one, or the smallest url if distances are equal
+			// so that the result is deterministic
+			d := Distance(fp, idx.urls[candidate])
+			if d < distance || (d == distance && candidate < found) {
+				found, distance = candidate, d
+			}
+		}
+	}
+
+	return found, found != ""
+}
+
+// Add adds fingerprint of url into index, the previous fingerprint of url will be replaced.
+func (idx *Index) Add(url string, fp uint64) {
+	idx.mux.Lock()
+	defer idx.mux.Unlock()
+
+	idx.add(url, fp)
+}
+
+// FindOrAdd returns the near-duplicate of url if found, otherwise fingerprint of url
+// will be added into index.
+func (idx *Index) FindOrAdd(url string, fp uint64) (string, bool) {
+	idx.mux.Lock()
+	defer idx.mux.Unlock()
+
+	if dup, ok := idx.find(url, fp); ok {
+		return dup, true
+	}
+
+	idx.add(url, fp)
+	return "", false
+}
+
+func (idx *Index) add(url string, fp uint64) {
+	if old, ok := idx.urls[url]; ok {
+		if old == fp {
+			return
+		}
+		idx.remove(url, old)
+	}
+
+	idx.urls[url] = fp
+	for i, m := range idx.masks {
+		block := (fp >> m.shift) & m.mask
+		if idx.blocks[i][block] == nil {
+			idx.blocks[i][block] = make(map[string]struct{})
+		}
+		idx.blocks[i][block][url] = struct{}{}
+	}
+}
+
+func (idx *Index) remove(url string, fp uint64) {
+	for i, m := range idx.masks {
+		block := (fp >> m.shift) & m.mask
+		delete(idx.blocks[i][block], url)
+		if len(idx.blocks[i][block]) == 0 {
+			delete(idx.blocks[i], block)
+		}
+	}
+	delete(idx.urls, url)
+}
+
+// Len returns the number of urls in index.
+func (idx *Index) Len() int {
+	idx.mux.RLock()
+	defer idx.mux.RUnlock()
+
+	return len(idx.urls)
+}
+
+// Save writes fingerprints into file, it does nothing if path is empty.
+func (idx *Index) Save() error {
+	if idx.path == "" {
+		return nil
+	}
+
+	idx.mux.RLock()
+	saved := make(map[string]string, len(idx.urls))
+	for url, fp := range idx.urls {
+		saved[url] = strconv.FormatUint(fp, 16)
+	}
+	idx.mux.RUnlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(idx.path, data, 0644)
+}
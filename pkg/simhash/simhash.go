@@ -0,0 +1,76 @@
+// Package simhash detects near-duplicate pages by SimHash fingerprints of their visible text.
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Fingerprint computes the 64-bit SimHash of text. Features are shingles of three
+// consecutive words, so that texts sharing most phrases have close fingerprints.
+func Fingerprint(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	if len(words) == 0 {
+		return 0
+	}
+
+	const shingleSize = 3
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(words) || i == 0; i++ {
+		end := i + shingleSize
+		if end > len(words) {
+			end = len(words)
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		sum := h.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fp uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fp |= 1 << uint(bit)
+		}
+	}
+
+	return fp
+}
+
+// Distance returns the hamming distance between two fingerprints.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// VisibleText returns text of document that is visible to users, contents of scripts,
+// styles and other invisible elements are excluded.
+func VisibleText(doc *goquery.Document) string {
+	if doc == nil {
+		return ""
+	}
+
+	sel := doc.Find("body")
+	if sel.Length() == 0 {
+		sel = doc.Selection
+	}
+
+	sel = sel.Clone()
+	sel.Find("script, style, noscript, template, iframe, svg, head").Remove()
+
+	return strings.Join(strings.Fields(sel.Text()), " ")
+}
@@ -0,0 +1,219 @@
+package simhash
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/jiandahao/goscrapy"
+)
+
+const article = `Go is an open source programming language supported by Google. It is easy to
+learn and great for teams, with built-in concurrency and a robust standard library. A large
+ecosystem of partners, communities and tools keeps growing every year.`
+
+func TestFingerprint(t *testing.T) {
+	cases := []struct {
+		name        string
+		a, b        string
+		maxDistance int
+		minDistance int
+	}{
+		{name: "identical", a: article, b: article, maxDistance: 0},
+		{name: "case and punctuation", a: article, b: strings.ToUpper(strings.Replace(article, ".", "!", -1)), maxDistance: 0},
+		{name: "whitespace", a: article, b: strings.Join(strings.Fields(article), "   "), maxDistance: 0},
+		{name: "one word changed", a: article, b: strings.Replace(article, "every year", "every month", 1), maxDistance: 10},
+		{name: "different text", a: article, b: "The quick brown fox jumps over the lazy dog while the cat sleeps on a warm sofa.", minDistance: 11, maxDistance: 64},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := Distance(Fingerprint(c.a), Fingerprint(c.b))
+			if d < c.minDistance || d > c.maxDistance {
+				t.Errorf("distance = %d, want %d to %d", d, c.minDistance, c.maxDistance)
+			}
+		})
+	}
+}
+
+func TestFingerprintShortText(t *testing.T) {
+	if fp := Fingerprint(" ... "); fp != 0 {
+		t.Errorf("Fingerprint of text without words = %x, want 0", fp)
+	}
+
+	if Fingerprint("hello") == 0 || Fingerprint("hello") == Fingerprint("world") {
+		t.Errorf("texts shorter than a shingle should still be fingerprinted")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		a, b uint64
+		want int
+	}{
+		{a: 0, b: 0, want: 0},
+		{a: 0, b: 1, want: 1},
+		{a: 0xF0, b: 0x0F, want: 8},
+		{a: 0, b: ^uint64(0), want: 64},
+	}
+
+	for _, c := range cases {
+		if got := Distance(c.a, c.b); got != c.want {
+			t.Errorf("Distance(%x, %x) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestVisibleText(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html>
+<head><title>Title</title><style>body { color: red }</style></head>
+<body>
+	<script>var a = 1;</script>
+	<h1>Hello</h1>
+	<p>visible
+		text</p>
+	<noscript>enable javascript</noscript>
+</body>
+</html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := VisibleText(doc), "Hello visible text"; got != want {
+		t.Errorf("VisibleText() = %q, want %q", got, want)
+	}
+
+	if got := VisibleText(nil); got != "" {
+		t.Errorf("VisibleText(nil) = %q, want empty", got)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	const base uint64 = 0x0123456789ABCDEF
+
+	cases := []struct {
+		name     string
+		distance int
+		fp       uint64
+		wantDup  string
+	}{
+		{name: "identical", distance: 3, fp: base, wantDup: "http://a.com/1"},
+		{name: "within distance", distance: 3, fp: base ^ 0x8000000000000101, wantDup: "http://a.com/1"},
+		{name: "out of distance", distance: 3, fp: base ^ 0x8000000000001101},
+		{name: "zero distance", distance: 0, fp: base ^ 1},
+		{name: "closest one", distance: 8, fp: base ^ 0xFF00, wantDup: "http://a.com/2"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			idx, err := NewIndex("", c.distance)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			idx.Add("http://a.com/1", base)
+			idx.Add("http://a.com/2", base^0x0F00)
+
+			dup, ok := idx.FindOrAdd("http://a.com/new", c.fp)
+			if dup != c.wantDup || ok != (c.wantDup != "") {
+				t.Errorf("FindOrAdd() = %q, %v, want %q", dup, ok, c.wantDup)
+			}
+
+			wantLen := 2
+			if !ok {
+				wantLen = 3
+			}
+
+			if idx.Len() != wantLen {
+				t.Errorf("Len() = %d, want %d", idx.Len(), wantLen)
+			}
+		})
+	}
+}
+
+func TestIndexReplace(t *testing.T) {
+	idx, _ := NewIndex("", 3)
+	idx.Add("http://a.com/1", 0)
+	idx.Add("http://a.com/1", ^uint64(0))
+
+	if dup, ok := idx.Find("http://a.com/2", 0); ok {
+		t.Errorf("Find() = %q, the previous fingerprint should be replaced", dup)
+	}
+
+	if dup, ok := idx.Find("http://a.com/1", ^uint64(0)); ok {
+		t.Errorf("Find() = %q, url itself should not be returned", dup)
+	}
+
+	if dup, _ := idx.Find("http://a.com/2", ^uint64(0)); dup != "http://a.com/1" {
+		t.Errorf("Find() = %q, want http://a.com/1", dup)
+	}
+}
+
+func TestIndexSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simhash.json")
+
+	idx, err := NewIndex(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx.Add("http://a.com/1", 0xDEADBEEF)
+	idx.Add("http://a.com/2", ^uint64(0))
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+
+	loaded, err := NewIndex(path, 3)
+	if err != nil {
+		t.Fatalf("NewIndex error: %v", err)
+	}
+
+	if loaded.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", loaded.Len())
+	}
+
+	if dup, _ := loaded.Find("http://a.com/3", ^uint64(0)); dup != "http://a.com/2" {
+		t.Errorf("Find() = %q, want http://a.com/2", dup)
+	}
+}
+
+func TestDedupHandle(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      DedupConfig
+		url      string
+		wantDrop bool
+		wantDup  interface{}
+	}{
+		{name: "unique page", url: "http://a.com/1"},
+		{name: "tag duplicate", url: "http://a.com/2?sid=1", wantDup: "http://a.com/2"},
+		{name: "custom field", cfg: DedupConfig{DuplicateField: "dup"}, url: "http://a.com/2?sid=1", wantDup: "http://a.com/2"},
+		{name: "drop duplicate", cfg: DedupConfig{DropDuplicates: true}, url: "http://a.com/2?sid=1", wantDrop: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := NewDedup(c.cfg)
+			d.dups.Store("http://a.com/2?sid=1", "http://a.com/2")
+
+			items := goscrapy.NewItems("article")
+			items.Store("url", c.url)
+
+			err := d.Handle(items)
+			if drop := errors.Is(err, goscrapy.ErrDropItem); drop != c.wantDrop {
+				t.Fatalf("Handle() error = %v, want drop %v", err, c.wantDrop)
+			}
+
+			if c.wantDrop {
+				return
+			}
+
+			dup, _ := items.Load(d.cfg.DuplicateField)
+			if dup != c.wantDup {
+				t.Errorf("duplicate field = %v, want %v", dup, c.wantDup)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+// Package spiders provides built-in spiders for common crawling jobs.
+package spiders
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jiandahao/goscrapy"
+	"github.com/jiandahao/goutils/logger"
+)
+
+// SeedFormat represents the format of seeds source
+type SeedFormat string
+
+// all supported seeds formats
+const (
+	SeedText      SeedFormat = "text"      // one url per line, blank lines and lines starting with # are ignored
+	SeedCSV       SeedFormat = "csv"       // csv with header, url is read from the column of URLField
+	SeedJSONLines SeedFormat = "jsonlines" // one json object per line, url is read from the field of URLField
+)
+
+// ContextKeyLine is the context key of request holding the line number of seed.
+const ContextKeyLine = "seed_line"
+
+// ParseFunc parses response, see Spider.Parse.
+type ParseFunc func(ctx *goscrapy.Context) (*goscrapy.Items, []*goscrapy.Request, error)
+
+// ListConfig list spider config
+type ListConfig struct {
+	Name string // spider name, "list_spider" by default
+	// Path is the path of seeds file, reading from stdin if empty or "-".
+	Path string
+	// Reader reads seeds from reader instead of Path if not nil.
+	Reader io.Reader
+	Format SeedFormat // SeedText by default
+	// URLField is the column of CSV or the field of JSON Lines holding url, "url" by default.
+	URLField string
+	// MetaFields are columns or fields passed into request by Request.WithContextValue,
+	// all fields except URLField will be passed if empty.
+	MetaFields []string
+	Method     string      // request method, GET by default
+	Header     http.Header // request header
+}
+
+var _ goscrapy.Spider = &ListSpider{}
+var _ goscrapy.StartRequestStreamer = &ListSpider{}
+var _ goscrapy.LoggerAware = &ListSpider{}
+
+// ListSpider is a spider that crawls urls read from a text file, CSV, JSON Lines or stdin,
+// so that a one-off crawl only needs a parse function. Seeds are streamed lazily, and
+// metadata of every seed is passed into request context. Responses of urls sharing
+// hosts with seeds will be parsed by the spider. Invalid seeds are logged and skipped.
+/* for example:
+spider := spiders.NewListSpider(spiders.ListConfig{
+	Path:   "seeds.csv",
+	Format: spiders.SeedCSV,
+}, func(ctx *goscrapy.Context) (*goscrapy.Items, []*goscrapy.Request, error) {
+	items := goscrapy.NewItems("page")
+	items.Store("category", ctx.Request().ContextValue("category"))
+	items.Store("title", ctx.Document().Find("title").Text())
+	return items, nil, nil
+})
+*/
+type ListSpider struct {
+	cfg     ListConfig
+	parse   ParseFunc
+	matcher *goscrapy.HostMatcher
+	lg      logger.Logger
+}
+
+// NewListSpider creates a list spider.
+func NewListSpider(cfg ListConfig, parse ParseFunc) *ListSpider {
+	if cfg.Name == "" {
+		cfg.Name = "list_spider"
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = SeedText
+	}
+
+	if cfg.URLField == "" {
+		cfg.URLField = "url"
+	}
+
+	return &ListSpider{
+		cfg:     cfg,
+		parse:   parse,
+		matcher: goscrapy.NewHostMatcher(),
+		lg:      logger.NewDefaultLogger("info"),
+	}
+}
+
+// SetLogger sets the logger, it's called by engine when registering spiders.
+func (s *ListSpider) SetLogger(lg logger.Logger) {
+	s.lg = lg
+}
+
+// Name returns the spider name
+func (s *ListSpider) Name() string {
+	return s.cfg.Name
+}
+
+// StartRequests returns nothing, start requests are streamed by StreamStartRequests.
+func (s *ListSpider) StartRequests() []*goscrapy.Request {
+	return nil
+}
+
+// URLMatcher returns the matcher matching hosts of all seeds read so far.
+func (s *ListSpider) URLMatcher() goscrapy.URLMatcher {
+	return s.matcher
+}
+
+// Parse parses response using the parse function.
+func (s *ListSpider) Parse(ctx *goscrapy.Context) (*goscrapy.Items, []*goscrapy.Request, error) {
+	if s.parse == nil {
+		return nil, nil, nil
+	}
+	return s.parse(ctx)
+}
+
+// StreamStartRequests reads seeds and sends requests into out.
+func (s *ListSpider) StreamStartRequests(ctx context.Context, out chan<- *goscrapy.Request) error {
+	r := s.cfg.Reader
+	if r == nil {
+		if s.cfg.Path == "" || s.cfg.Path == "-" {
+			r = os.Stdin
+		} else {
+			fd, err := os.Open(s.cfg.Path)
+			if err != nil {
+				return err
+			}
+			defer fd.Close()
+			r = fd
+		}
+	}
+
+	send := func(line int, rawURL string, meta map[string]interface{}) error {
+		req, err := s.newRequest(line, rawURL, meta)
+		if err != nil {
+			// skip invalid seed
+			s.lg.Warnf(ctx, "invalid seed at line %d: %v", line, err)
+			return nil
+		}
+
+		select {
+		case out <- req:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	switch s.cfg.Format {
+	case SeedText:
+		return s.readText(r, send)
+	case SeedCSV:
+		return s.readCSV(r, send)
+	case SeedJSONLines:
+		return s.readJSONLines(ctx, r, send)
+	default:
+		return fmt.Errorf("unsupported seed format: %s", s.cfg.Format)
+	}
+}
+
+type sendFunc func(line int, rawURL string, meta map[string]interface{}) error
+
+func (s *ListSpider) readText(r io.Reader, send sendFunc) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var line int
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if err := send(line, text, nil); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (s *ListSpider) readCSV(r io.Reader, send sendFunc) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	urlIndex := -1
+	for index, column := range header {
+		if strings.TrimSpace(column) == s.cfg.URLField {
+			urlIndex = index
+			break
+		}
+	}
+
+	if urlIndex < 0 {
+		return fmt.Errorf("column %s not found", s.cfg.URLField)
+	}
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		line++
+
+		if err != nil {
+			return err
+		}
+
+		if urlIndex >= len(record) {
+			continue
+		}
+
+		meta := make(map[string]interface{}, len(record))
+		for index, val := range record {
+			if index < len(header) {
+				meta[strings.TrimSpace(header[index])] = val
+			}
+		}
+
+		if err := send(line, record[urlIndex], meta); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ListSpider) readJSONLines(ctx context.Context, r io.Reader, send sendFunc) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var line int
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		var meta map[string]interface{}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			s.lg.Warnf(ctx, "invalid seed at line %d: %v", line, err)
+			continue
+		}
+
+		rawURL, _ := meta[s.cfg.URLField].(string)
+		if err := send(line, rawURL, meta); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (s *ListSpider) newRequest(line int, rawURL string, meta map[string]interface{}) (*goscrapy.Request, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return nil, errors.New("empty url")
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid url: %s", rawURL)
+	}
+	s.matcher.Add(u.Host)
+
+	req := &goscrapy.Request{
+		Method: s.cfg.Method,
+		URL:    rawURL,
+	}
+
+	if s.cfg.Header != nil {
+		req.Header = s.cfg.Header.Clone()
+	}
+
+	req.WithContextValue(ContextKeyLine, line)
+	if len(s.cfg.MetaFields) > 0 {
+		for _, field := range s.cfg.MetaFields {
+			if val, ok := meta[field]; ok {
+				req.WithContextValue(field, val)
+			}
+		}
+		return req, nil
+	}
+
+	for field, val := range meta {
+		if field == s.cfg.URLField {
+			continue
+		}
+		req.WithContextValue(field, val)
+	}
+
+	return req, nil
+}
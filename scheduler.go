@@ -2,7 +2,10 @@ package goscrapy
 
 import (
 	"container/heap"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/jiandahao/goutils/channel"
 )
@@ -16,6 +19,13 @@ type Scheduler interface {
 	HasMore() bool                            // returns true if there are more request to be scheduled
 }
 
+// NonBlockingScheduler is an optional interface implemented by schedulers whose PushRequest
+// never blocks. Engine pushes requests generated by spiders into such schedulers synchronously,
+// so that the order of requests is decided by scheduler rather than goroutine scheduling.
+type NonBlockingScheduler interface {
+	NonBlocking() bool
+}
+
 var _ Scheduler = &FIFOScheduler{}
 
 // FIFOScheduler default scheduler implementation
@@ -63,7 +73,8 @@ func (ds *FIFOScheduler) HasMore() bool {
 
 var _ Scheduler = &WeightedScheduler{}
 
-// WeightedScheduler scheduler
+// WeightedScheduler scheduler. It does not guarantee the order of requests with the same
+// weight, using NewPriorityScheduler(ByWeight) instead if the order matters.
 type WeightedScheduler struct {
 	data []*Request
 	mux  sync.RWMutex
@@ -157,3 +168,555 @@ func (sched *WeightedScheduler) Pop() interface{} {
 
 	return res
 }
+
+// Strategy returns the priority of request, requests with higher priority will be
+// scheduled first.
+type Strategy func(req *Request) int
+
+// ByWeight schedules requests by Request.Weight.
+func ByWeight(req *Request) int {
+	return req.Weight
+}
+
+// BreadthFirst schedules requests in breadth-first order, requests with lower depth
+// will be scheduled first.
+func BreadthFirst(req *Request) int {
+	return -req.Depth()
+}
+
+// DepthFirst schedules requests in depth-first order, requests with higher depth
+// will be scheduled first.
+func DepthFirst(req *Request) int {
+	return req.Depth()
+}
+
+// DepthPriority returns a strategy that adjusts Request.Weight by depth, the priority
+// of request is Weight - depth*k. Positive k prefers shallow requests, while negative k
+// prefers deep requests.
+func DepthPriority(k int) Strategy {
+	return func(req *Request) int {
+		return req.Weight - req.Depth()*k
+	}
+}
+
+var _ Scheduler = &PriorityScheduler{}
+var _ NonBlockingScheduler = &PriorityScheduler{}
+
+// PriorityScheduler schedules requests by priority returned by strategy. Requests with
+// the same priority are scheduled in FIFO order. Unlike FIFOScheduler, the queue is not
+// bounded so that priorities of all requests are taken into account.
+type PriorityScheduler struct {
+	strategy Strategy
+	queue    priorityQueue
+	seq      uint64 // sequence number of the next pushed request
+	stopped  bool
+	mux      sync.Mutex
+	cond     *sync.Cond
+}
+
+// NewPriorityScheduler creates a priority scheduler scheduling requests with strategy.
+func NewPriorityScheduler(strategy Strategy) *PriorityScheduler {
+	if strategy == nil {
+		strategy = ByWeight
+	}
+
+	ps := &PriorityScheduler{strategy: strategy}
+	ps.cond = sync.NewCond(&ps.mux)
+	return ps
+}
+
+// Start starts scheduler
+func (ps *PriorityScheduler) Start() error {
+	return nil
+}
+
+// Stop stops scheduler, requests left in queue will be dropped.
+func (ps *PriorityScheduler) Stop() error {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+
+	ps.stopped = true
+	ps.queue = nil
+	ps.cond.Broadcast()
+	return nil
+}
+
+// PushRequest adds request, it returns false if scheduler has been stopped.
+func (ps *PriorityScheduler) PushRequest(req *Request) (ok bool) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+
+	if ps.stopped {
+		return false
+	}
+
+	heap.Push(&ps.queue, &priorityEntry{
+		req:      req,
+		priority: ps.strategy(req),
+		seq:      ps.seq,
+	})
+	ps.seq++
+	ps.cond.Signal()
+
+	return true
+}
+
+// PopRequest returns the request with the highest priority, it blocks until there is
+// a request or scheduler has been stopped.
+func (ps *PriorityScheduler) PopRequest() (req *Request, hasMore bool) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+
+	for len(ps.queue) == 0 && !ps.stopped {
+		ps.cond.Wait()
+	}
+
+	if ps.stopped {
+		return nil, false
+	}
+
+	entry := heap.Pop(&ps.queue).(*priorityEntry)
+	return entry.req, true
+}
+
+// NonBlocking returns true as PushRequest never blocks.
+func (ps *PriorityScheduler) NonBlocking() bool {
+	return true
+}
+
+// HasMore returns true if there are more request to be scheduled
+func (ps *PriorityScheduler) HasMore() bool {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+
+	return len(ps.queue) > 0
+}
+
+type priorityEntry struct {
+	req      *Request
+	priority int
+	seq      uint64
+}
+
+// priorityQueue implements heap.Interface, entries with higher priority or pushed
+// earlier come first.
+type priorityQueue []*priorityEntry
+
+func (pq priorityQueue) Len() int {
+	return len(pq)
+}
+
+func (pq priorityQueue) Less(i, j int) bool {
+	if pq[i].priority != pq[j].priority {
+		return pq[i].priority > pq[j].priority
+	}
+	return pq[i].seq < pq[j].seq
+}
+
+func (pq priorityQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+}
+
+func (pq *priorityQueue) Push(x interface{}) {
+	*pq = append(*pq, x.(*priorityEntry))
+}
+
+func (pq *priorityQueue) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*pq = old[:n-1]
+	return entry
+}
+
+// QueueKeyFunc returns the key of queue that request belongs to.
+type QueueKeyFunc func(req *Request) string
+
+// HostKey puts requests with the same host into the same queue.
+func HostKey(req *Request) string {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// SpiderKey puts requests generated by the same spider into the same queue.
+func SpiderKey(req *Request) string {
+	return req.SpiderName()
+}
+
+// HostSchedulerConfig host scheduler config
+type HostSchedulerConfig struct {
+	// Key returns the queue key of request, HostKey by default.
+	Key QueueKeyFunc
+	// Delay is the minimum interval between two requests popped from the same queue.
+	Delay time.Duration
+	// Delays overrides Delay for queues of specific keys.
+	Delays map[string]time.Duration
+	// Weights maps queue keys to the number of requests served in a row before switching
+	// to the next queue, 1 by default, which means round-robin.
+	Weights map[string]int
+}
+
+var _ Scheduler = &HostScheduler{}
+var _ NonBlockingScheduler = &HostScheduler{}
+
+// HostScheduler keeps a FIFO queue per host (or per spider, see HostSchedulerConfig.Key)
+// and serves queues in round-robin or weighted-fair order, so that a site returning lots
+// of links won't starve the others. Queues are cooled down for the configured delay after
+// serving a request, a ready queue is always chosen over the ones still cooling down.
+type HostScheduler struct {
+	cfg     HostSchedulerConfig
+	queues  map[string][]*Request
+	ring    []string // keys of non-empty queues in order of serving
+	cursor  int      // index of queue being served in ring
+	credits int      // number of requests that the current queue could still serve in a row
+	readyAt map[string]time.Time
+	count   int // number of requests in all queues
+	stopped bool
+	mux     sync.Mutex
+	cond    *sync.Cond
+}
+
+// NewHostScheduler creates a host scheduler.
+func NewHostScheduler(cfg HostSchedulerConfig) *HostScheduler {
+	if cfg.Key == nil {
+		cfg.Key = HostKey
+	}
+
+	hs := &HostScheduler{
+		cfg:     cfg,
+		queues:  make(map[string][]*Request),
+		readyAt: make(map[string]time.Time),
+	}
+	hs.cond = sync.NewCond(&hs.mux)
+
+	return hs
+}
+
+// Start starts scheduler
+func (hs *HostScheduler) Start() error {
+	return nil
+}
+
+// Stop stops scheduler, requests left in queues will be dropped.
+func (hs *HostScheduler) Stop() error {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+
+	hs.stopped = true
+	hs.queues = make(map[string][]*Request)
+	hs.ring = nil
+	hs.count = 0
+	hs.cond.Broadcast()
+	return nil
+}
+
+// PushRequest adds request into its queue, it returns false if scheduler has been stopped.
+func (hs *HostScheduler) PushRequest(req *Request) (ok bool) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+
+	if hs.stopped {
+		return false
+	}
+
+	key := hs.cfg.Key(req)
+	queue, exists := hs.queues[key]
+	if !exists {
+		hs.ring = append(hs.ring, key)
+	}
+
+	hs.queues[key] = append(queue, req)
+	hs.count++
+	hs.cond.Signal()
+
+	return true
+}
+
+// PopRequest returns the next request of the next ready queue, it blocks until there
+// is a ready request or scheduler has been stopped.
+func (hs *HostScheduler) PopRequest() (req *Request, hasMore bool) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+
+	for {
+		if hs.stopped {
+			return nil, false
+		}
+
+		req, wait := hs.next(time.Now())
+		if req != nil {
+			return req, true
+		}
+
+		if wait <= 0 {
+			hs.cond.Wait()
+			continue
+		}
+
+		// waking up once the earliest queue is ready
+		timer := time.AfterFunc(wait, func() {
+			hs.mux.Lock()
+			hs.cond.Broadcast()
+			hs.mux.Unlock()
+		})
+		hs.cond.Wait()
+		timer.Stop()
+	}
+}
+
+// next pops request from the first ready queue starting from cursor. If no queue is
+// ready, it returns the duration to wait until the earliest queue is ready, or 0 if all
+// queues are empty.
+func (hs *HostScheduler) next(now time.Time) (*Request, time.Duration) {
+	var wait time.Duration
+	for i := 0; i < len(hs.ring); i++ {
+		index := (hs.cursor + i) % len(hs.ring)
+		key := hs.ring[index]
+
+		if readyAt, ok := hs.readyAt[key]; ok && readyAt.After(now) {
+			if d := readyAt.Sub(now); wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		if index != hs.cursor || hs.credits <= 0 {
+			hs.cursor = index
+			hs.credits = hs.weight(key)
+		}
+
+		queue := hs.queues[key]
+		req := queue[0]
+		queue[0] = nil
+		queue = queue[1:]
+		hs.count--
+		hs.credits--
+
+		if delay := hs.delay(key); delay > 0 {
+			hs.readyAt[key] = now.Add(delay)
+		} else {
+			delete(hs.readyAt, key)
+		}
+
+		if len(queue) == 0 {
+			// removing empty queue, cursor points to the next queue now
+			delete(hs.queues, key)
+			hs.ring = append(hs.ring[:index], hs.ring[index+1:]...)
+			hs.credits = 0
+			if hs.cursor >= len(hs.ring) {
+				hs.cursor = 0
+			}
+		} else {
+			hs.queues[key] = queue
+			if hs.credits <= 0 {
+				hs.cursor = (index + 1) % len(hs.ring)
+			}
+		}
+
+		return req, 0
+	}
+
+	return nil, wait
+}
+
+func (hs *HostScheduler) delay(key string) time.Duration {
+	if delay, ok := hs.cfg.Delays[key]; ok {
+		return delay
+	}
+	return hs.cfg.Delay
+}
+
+func (hs *HostScheduler) weight(key string) int {
+	if weight, ok := hs.cfg.Weights[key]; ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// NonBlocking returns true as PushRequest never blocks.
+func (hs *HostScheduler) NonBlocking() bool {
+	return true
+}
+
+// HasMore returns true if there are more request to be scheduled
+func (hs *HostScheduler) HasMore() bool {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+
+	return hs.count > 0
+}
+
+var _ Scheduler = &DelayScheduler{}
+var _ NonBlockingScheduler = &DelayScheduler{}
+
+// DelayScheduler wraps a scheduler to support Request.NotBefore. Requests that are not due
+// are held in a min-heap ordered by NotBefore and pushed into the wrapped scheduler once
+// they are due, so that workers never sleep waiting for them. HasMore returns true while
+// there are delayed requests, which keeps engine alive. Engine wraps its scheduler with
+// DelayScheduler automatically when starting.
+type DelayScheduler struct {
+	sched   Scheduler
+	delayed delayQueue
+	seq     uint64 // sequence number of the next delayed request
+	moving  int    // number of due requests being pushed into the wrapped scheduler
+	stopped bool
+	mux     sync.Mutex
+	cond    *sync.Cond
+}
+
+// NewDelayScheduler creates a delay scheduler wrapping sched.
+func NewDelayScheduler(sched Scheduler) *DelayScheduler {
+	ds := &DelayScheduler{sched: sched}
+	ds.cond = sync.NewCond(&ds.mux)
+	return ds
+}
+
+// Start starts scheduler
+func (ds *DelayScheduler) Start() error {
+	if err := ds.sched.Start(); err != nil {
+		return err
+	}
+
+	go ds.run()
+	return nil
+}
+
+// Stop stops scheduler, delayed requests will be dropped.
+func (ds *DelayScheduler) Stop() error {
+	ds.mux.Lock()
+	ds.stopped = true
+	ds.delayed = nil
+	ds.cond.Broadcast()
+	ds.mux.Unlock()
+
+	return ds.sched.Stop()
+}
+
+// PushRequest adds request, requests that are not due will be held until NotBefore.
+func (ds *DelayScheduler) PushRequest(req *Request) (ok bool) {
+	if !req.NotBefore.After(time.Now()) {
+		return ds.sched.PushRequest(req)
+	}
+
+	ds.mux.Lock()
+	defer ds.mux.Unlock()
+
+	if ds.stopped {
+		return false
+	}
+
+	heap.Push(&ds.delayed, &delayEntry{req: req, seq: ds.seq})
+	ds.seq++
+	ds.cond.Signal()
+
+	return true
+}
+
+// PopRequest returns next request from the wrapped scheduler.
+func (ds *DelayScheduler) PopRequest() (req *Request, hasMore bool) {
+	return ds.sched.PopRequest()
+}
+
+// HasMore returns true if there are more request to be scheduled, including delayed requests.
+func (ds *DelayScheduler) HasMore() bool {
+	ds.mux.Lock()
+	pending := len(ds.delayed) + ds.moving
+	ds.mux.Unlock()
+
+	return pending > 0 || ds.sched.HasMore()
+}
+
+// NonBlocking returns true if the wrapped scheduler never blocks.
+func (ds *DelayScheduler) NonBlocking() bool {
+	nb, ok := ds.sched.(NonBlockingScheduler)
+	return ok && nb.NonBlocking()
+}
+
+// run pushes due requests into the wrapped scheduler until scheduler has been stopped.
+func (ds *DelayScheduler) run() {
+	for {
+		ds.mux.Lock()
+		for !ds.stopped {
+			if len(ds.delayed) == 0 {
+				ds.cond.Wait()
+				continue
+			}
+
+			wait := time.Until(ds.delayed[0].req.NotBefore)
+			if wait <= 0 {
+				break
+			}
+
+			// waking up once the earliest request is due
+			timer := time.AfterFunc(wait, func() {
+				ds.mux.Lock()
+				ds.cond.Broadcast()
+				ds.mux.Unlock()
+			})
+			ds.cond.Wait()
+			timer.Stop()
+		}
+
+		if ds.stopped {
+			ds.mux.Unlock()
+			return
+		}
+
+		var due []*Request
+		now := time.Now()
+		for len(ds.delayed) > 0 && !ds.delayed[0].req.NotBefore.After(now) {
+			due = append(due, heap.Pop(&ds.delayed).(*delayEntry).req)
+		}
+		ds.moving += len(due)
+		ds.mux.Unlock()
+
+		for _, req := range due {
+			ds.sched.PushRequest(req)
+
+			ds.mux.Lock()
+			ds.moving--
+			ds.mux.Unlock()
+		}
+	}
+}
+
+type delayEntry struct {
+	req *Request
+	seq uint64
+}
+
+// delayQueue implements heap.Interface, entries that are due earlier or pushed
+// earlier come first.
+type delayQueue []*delayEntry
+
+func (dq delayQueue) Len() int {
+	return len(dq)
+}
+
+func (dq delayQueue) Less(i, j int) bool {
+	if !dq[i].req.NotBefore.Equal(dq[j].req.NotBefore) {
+		return dq[i].req.NotBefore.Before(dq[j].req.NotBefore)
+	}
+	return dq[i].seq < dq[j].seq
+}
+
+func (dq delayQueue) Swap(i, j int) {
+	dq[i], dq[j] = dq[j], dq[i]
+}
+
+func (dq *delayQueue) Push(x interface{}) {
+	*dq = append(*dq, x.(*delayEntry))
+}
+
+func (dq *delayQueue) Pop() interface{} {
+	old := *dq
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*dq = old[:n-1]
+	return entry
+}
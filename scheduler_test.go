@@ -0,0 +1,229 @@
+package goscrapy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// popURLs pops n requests from scheduler and returns their urls.
+func popURLs(t *testing.T, sched Scheduler, n int) []string {
+	t.Helper()
+
+	var urls []string
+	for i := 0; i < n; i++ {
+		req, ok := sched.PopRequest()
+		if !ok {
+			t.Fatalf("PopRequest returned no request after %d requests", i)
+		}
+		urls = append(urls, req.URL)
+	}
+
+	return urls
+}
+
+func TestPriorityScheduler(t *testing.T) {
+	type request struct {
+		url    string
+		weight int
+		depth  int
+	}
+
+	requests := []request{
+		{url: "a", weight: 0, depth: 1},
+		{url: "b", weight: 5, depth: 3},
+		{url: "c", weight: 1, depth: 2},
+		{url: "d", weight: 5, depth: 1},
+		{url: "e", weight: 0, depth: 2},
+	}
+
+	cases := []struct {
+		name     string
+		strategy Strategy
+		want     []string
+	}{
+		{name: "by weight", strategy: ByWeight, want: []string{"b", "d", "c", "a", "e"}},
+		{name: "nil strategy is by weight", strategy: nil, want: []string{"b", "d", "c", "a", "e"}},
+		{name: "breadth first", strategy: BreadthFirst, want: []string{"a", "d", "c", "e", "b"}},
+		{name: "depth first", strategy: DepthFirst, want: []string{"b", "c", "e", "a", "d"}},
+		{name: "depth priority prefers shallow", strategy: DepthPriority(3), want: []string{"d", "a", "b", "c", "e"}},
+		{name: "depth priority prefers deep", strategy: DepthPriority(-3), want: []string{"b", "d", "c", "e", "a"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sched := NewPriorityScheduler(c.strategy)
+			for _, r := range requests {
+				req := &Request{URL: r.url, Weight: r.weight, currentDepth: r.depth}
+				if !sched.PushRequest(req) {
+					t.Fatalf("PushRequest(%s) = false", r.url)
+				}
+			}
+
+			if got := popURLs(t, sched, len(requests)); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+
+			if sched.HasMore() {
+				t.Errorf("HasMore() = true after popping all requests")
+			}
+		})
+	}
+}
+
+func TestPrioritySchedulerStop(t *testing.T) {
+	sched := NewPriorityScheduler(ByWeight)
+	sched.PushRequest(&Request{URL: "a"})
+	sched.Stop()
+
+	if sched.PushRequest(&Request{URL: "b"}) {
+		t.Errorf("PushRequest = true after stopped")
+	}
+
+	if req, ok := sched.PopRequest(); ok {
+		t.Errorf("PopRequest = %v after stopped, want none", req.URL)
+	}
+}
+
+func TestHostScheduler(t *testing.T) {
+	type request struct {
+		url    string
+		spider string
+	}
+
+	requests := []request{
+		{url: "http://a.com/1", spider: "s1"},
+		{url: "http://a.com/2", spider: "s1"},
+		{url: "http://a.com/3", spider: "s1"},
+		{url: "http://a.com/4", spider: "s1"},
+		{url: "http://b.com/1", spider: "s2"},
+		{url: "http://b.com/2", spider: "s2"},
+		{url: "http://C.com/1", spider: "s2"},
+	}
+
+	cases := []struct {
+		name string
+		cfg  HostSchedulerConfig
+		want []string
+	}{
+		{
+			name: "round robin by host",
+			want: []string{
+				"http://a.com/1", "http://b.com/1", "http://C.com/1",
+				"http://a.com/2", "http://b.com/2", "http://a.com/3", "http://a.com/4",
+			},
+		},
+		{
+			name: "weighted",
+			cfg:  HostSchedulerConfig{Weights: map[string]int{"a.com": 2}},
+			want: []string{
+				"http://a.com/1", "http://a.com/2", "http://b.com/1", "http://C.com/1",
+				"http://a.com/3", "http://a.com/4", "http://b.com/2",
+			},
+		},
+		{
+			name: "round robin by spider",
+			cfg:  HostSchedulerConfig{Key: SpiderKey},
+			want: []string{
+				"http://a.com/1", "http://b.com/1", "http://a.com/2", "http://b.com/2",
+				"http://a.com/3", "http://C.com/1", "http://a.com/4",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sched := NewHostScheduler(c.cfg)
+			for _, r := range requests {
+				sched.PushRequest(&Request{URL: r.url, spider: r.spider})
+			}
+
+			if got := popURLs(t, sched, len(requests)); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+
+			if sched.HasMore() {
+				t.Errorf("HasMore() = true after popping all requests")
+			}
+		})
+	}
+}
+
+func TestHostSchedulerDelay(t *testing.T) {
+	delay := 50 * time.Millisecond
+	sched := NewHostScheduler(HostSchedulerConfig{Delays: map[string]time.Duration{"a.com": delay}})
+	for _, u := range []string{"http://a.com/1", "http://a.com/2", "http://b.com/1"} {
+		sched.PushRequest(&Request{URL: u})
+	}
+
+	start := time.Now()
+	want := []string{"http://a.com/1", "http://b.com/1", "http://a.com/2"}
+	if got := popURLs(t, sched, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("the second request of a.com is popped after %v, want at least %v", elapsed, delay)
+	}
+}
+
+func TestDelayScheduler(t *testing.T) {
+	sched := NewDelayScheduler(NewPriorityScheduler(ByWeight))
+	if err := sched.Start(); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer sched.Stop()
+
+	now := time.Now()
+	requests := []*Request{
+		{URL: "later", NotBefore: now.Add(80 * time.Millisecond)},
+		{URL: "soon", NotBefore: now.Add(40 * time.Millisecond)},
+		{URL: "past", NotBefore: now.Add(-time.Second)},
+		{URL: "now"},
+	}
+
+	for _, req := range requests {
+		if !sched.PushRequest(req) {
+			t.Fatalf("PushRequest(%s) = false", req.URL)
+		}
+	}
+
+	if !sched.HasMore() {
+		t.Errorf("HasMore() = false with delayed requests")
+	}
+
+	want := []string{"past", "now", "soon", "later"}
+	for _, url := range want {
+		req, ok := sched.PopRequest()
+		if !ok {
+			t.Fatalf("PopRequest returned no request, want %s", url)
+		}
+
+		if req.URL != url {
+			t.Errorf("got %s, want %s", req.URL, url)
+		}
+
+		if time.Now().Before(req.NotBefore) {
+			t.Errorf("request %s is popped before NotBefore", req.URL)
+		}
+	}
+
+	if sched.HasMore() {
+		t.Errorf("HasMore() = true after popping all requests")
+	}
+}
+
+func TestDelaySchedulerStop(t *testing.T) {
+	sched := NewDelayScheduler(NewPriorityScheduler(ByWeight))
+	sched.Start()
+	sched.PushRequest(&Request{URL: "later", NotBefore: time.Now().Add(time.Hour)})
+	sched.Stop()
+
+	if sched.HasMore() {
+		t.Errorf("HasMore() = true after stopped, delayed requests should be dropped")
+	}
+
+	if sched.PushRequest(&Request{URL: "later", NotBefore: time.Now().Add(time.Hour)}) {
+		t.Errorf("PushRequest = true after stopped")
+	}
+}
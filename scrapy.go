@@ -2,11 +2,14 @@ package goscrapy
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/jiandahao/goutils/logger"
 )
 
 // RequestHandleFunc request handler func
@@ -21,10 +24,30 @@ type Request struct {
 	// using to decide scheduling sequence. It only means something when using a
 	// scheduler that schedules requests based on request weight.
 	Weight int
+	// NotBefore is the earliest time that request could be scheduled, e.g. retrying after
+	// the time specified by Retry-After. Request will be scheduled immediately if zero.
+	// Middlewares could use Request.Reschedule to schedule request again later.
+	NotBefore time.Time `json:"not_before,omitempty"`
+	// BrowserActions will be performed in order by browser based downloader after
+	// loading page and before capturing the DOM.
+	BrowserActions []BrowserAction `json:"browser_actions,omitempty"`
+	// Capture specifies screenshots or PDF to be captured by browser based downloader,
+	// captured files will be attached to Response.Artifacts.
+	Capture *CaptureOptions `json:"capture,omitempty"`
+	// Downloader is the name of downloader to download this request. It only means
+	// something when using RouterDownloader.
+	Downloader string `json:"downloader,omitempty"`
+	// DontFilter schedules request even if the same request has been scheduled before,
+	// see CanonicalizeURLs.
+	DontFilter bool `json:"dont_filter,omitempty"`
 
 	// private fields
-	currentDepth int  // current request depth
-	aborted      bool // true if request has been aborted
+	currentDepth int    // current request depth
+	aborted      bool   // true if request has been aborted
+	rescheduled  bool   // true if request should be scheduled again, see Reschedule
+	spider       string // name of spider that generated this request
+	run          int    // run of spider that generated this request, see RecurringSpider
+	originalURL  string // url before canonicalization
 	ctxMap       map[string]interface{}
 }
 
@@ -34,11 +57,56 @@ func (r *Request) Abort() {
 	r.aborted = true
 }
 
+// Reschedule aborts current request and schedules it again not before notBefore, you could
+// use it at your request or response middlewares, e.g. retrying after the time specified by
+// Retry-After. The response will not be parsed by spiders. It does nothing for requests
+// downloaded by pipelines through Engine.Download.
+/* for example:
+func RetryAfterMiddleware(resp *goscrapy.Response) error {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		resp.Request.Reschedule(time.Now().Add(time.Duration(seconds) * time.Second))
+	}
+	return nil
+}
+*/
+func (r *Request) Reschedule(notBefore time.Time) {
+	r.aborted = true
+	r.rescheduled = true
+	r.NotBefore = notBefore
+}
+
 // IsAborted returns true if the current request was aborted.
 func (r *Request) IsAborted() bool {
 	return r.aborted
 }
 
+// OriginalURL returns the url of request before canonicalized by engine (see
+// CanonicalizeURLs), it's the same as URL if not canonicalized.
+func (r *Request) OriginalURL() string {
+	if r.originalURL == "" {
+		return r.URL
+	}
+	return r.originalURL
+}
+
+// Depth returns the crawling depth of request, requests returned by StartRequests
+// have the depth of 1.
+func (r *Request) Depth() int {
+	return r.currentDepth
+}
+
+// Run returns the run number of spider that generated this request, it's always 1
+// unless spider implements RecurringSpider.
+func (r *Request) Run() int {
+	return r.run
+}
+
+// SpiderName returns the name of spider that generated this request.
+func (r *Request) SpiderName() string {
+	return r.spider
+}
+
 // WithContextValue sets the value into request associated with the key.
 func (r *Request) WithContextValue(key string, value interface{}) {
 	if r.ctxMap == nil {
@@ -80,6 +148,37 @@ type Response struct {
 	ContentLength int64 `json:"content_length,omitempty"`
 	// Header represents response header, maps header keys to values.
 	Header http.Header `json:"header,omitempty"`
+	// URL represents the final URL of response after following redirects, it might
+	// be empty if downloader does not support it.
+	URL string `json:"url,omitempty"`
+	// NetworkLog records all network activities (e.g. XHR requests and responses) that
+	// happened while downloading, only available for browser based downloader.
+	NetworkLog []*NetworkEntry `json:"network_log,omitempty"`
+	// ScriptResults maps the name of ActionExecuteScript browser actions to their results.
+	ScriptResults map[string]interface{} `json:"script_results,omitempty"`
+	// Artifacts represents files captured while downloading, e.g. screenshots.
+	Artifacts []*Artifact `json:"artifacts,omitempty"`
+
+	// private fields
+	jsonOnce sync.Once   // decodes json body only once, see JSONPath
+	jsonBody interface{} // decoded json body
+	jsonErr  error       // error of decoding json body
+}
+
+// NetworkEntry represents a request and its corresponding response observed
+// by browser during downloading.
+type NetworkEntry struct {
+	RequestID      string      `json:"request_id,omitempty"`
+	ResourceType   string      `json:"resource_type,omitempty"` // e.g. Document, XHR, Fetch, Script
+	Method         string      `json:"method,omitempty"`
+	URL            string      `json:"url,omitempty"`
+	RequestHeader  http.Header `json:"request_header,omitempty"`
+	Status         string      `json:"status,omitempty"`      // e.g. "200 OK"
+	StatusCode     int         `json:"status_code,omitempty"` // e.g. 200
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	MimeType       string      `json:"mime_type,omitempty"`
+	Failed         bool        `json:"failed,omitempty"` // true if request failed to load
+	ErrorText      string      `json:"error_text,omitempty"`
 }
 
 // Context represents the scraping and crawling context
@@ -109,7 +208,8 @@ func (ctx *Context) Document() *goquery.Document {
 // Items items
 type Items struct {
 	sync.Map
-	name string
+	name   string
+	spider string // name of spider that generated this items
 }
 
 // NewItems new items with specified name, goscrapy pipeline will
@@ -129,14 +229,29 @@ func (item *Items) Name() string {
 	return item.name
 }
 
+// SpiderName returns the name of spider that generated this items.
+func (item *Items) SpiderName() string {
+	return item.spider
+}
+
+// ItemName returns items' name, it's aimed to implement Item.
+func (item *Items) ItemName() string {
+	return item.name
+}
+
+// MarshalJSON encodes all key-value pairs stored in items as a JSON object.
+func (item *Items) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ItemToMap(item))
+}
+
 // Spider is an interface that defines how a certain site (or a group of sites) will be scraped,
 // including how to perform the crawl (i.e. follow links) and how to extract structured data
 // from their pages (i.e. scraping items). In other words, Spiders are the place where you define
 // the custom behavior for crawling and parsing pages for a particular site (or, in some cases, a group of sites).
 // For spiders, the scraping cycle goes through something like this:
-// 1. Using initial Requests generated by StartRequests to crawl the first URLs.
-// 2. Parsing the response (web page), then return items object (structured data) and request objects. Those requests
-//    will be added into scheduler by goscrapy engine and downloaded by downloader in the future.
+//  1. Using initial Requests generated by StartRequests to crawl the first URLs.
+//  2. Parsing the response (web page), then return items object (structured data) and request objects. Those requests
+//     will be added into scheduler by goscrapy engine and downloaded by downloader in the future.
 type Spider interface {
 	Name() string
 	StartRequests() []*Request
@@ -150,3 +265,31 @@ type Pipeline interface {
 	ItemList() []string // returns all items' name that this pipeline cares about
 	Handle(items *Items) error
 }
+
+// PipelineOpener is an optional interface implemented by pipelines that need to prepare
+// resources (e.g. opening files or database connections) before crawling. Open will be
+// called for every spider when engine starts, engine will not start if Open returns error.
+type PipelineOpener interface {
+	Open(ctx context.Context, spider Spider) error
+}
+
+// PipelineCloser is an optional interface implemented by pipelines that need to release
+// resources (e.g. flushing and closing files) after crawling. Close will be called for
+// every spider after all requests have been handled.
+type PipelineCloser interface {
+	Close(ctx context.Context, spider Spider) error
+}
+
+// DownloaderAware is an optional interface implemented by pipelines that need to download
+// resources referenced by items (e.g. images). Engine passes itself to SetDownloader when
+// registering pipelines, so that downloads sent by pipelines respect middlewares and delay
+// of engine, and are recorded into stats and budget, see Engine.Download.
+type DownloaderAware interface {
+	SetDownloader(d Downloader)
+}
+
+// LoggerAware is an optional interface implemented by pipelines or spiders that log, engine
+// passes its logger to SetLogger when registering them.
+type LoggerAware interface {
+	SetLogger(lg logger.Logger)
+}
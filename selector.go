@@ -0,0 +1,113 @@
+package goscrapy
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// XPath returns all nodes matched by the XPath expression over the parsed HTML document.
+func (resp *Response) XPath(expr string) ([]*html.Node, error) {
+	if resp.Document == nil || len(resp.Document.Nodes) == 0 {
+		return nil, errors.New("no html document")
+	}
+
+	var nodes []*html.Node
+	for _, root := range resp.Document.Nodes {
+		res, err := htmlquery.QueryAll(root, expr)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, res...)
+	}
+
+	return nodes, nil
+}
+
+// XPathStrings returns the text of all nodes matched by the XPath expression. For
+// attribute selection (e.g. //a/@href), it returns values of attributes.
+func (resp *Response) XPathStrings(expr string) ([]string, error) {
+	nodes, err := resp.XPath(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		res = append(res, htmlquery.InnerText(node))
+	}
+
+	return res, nil
+}
+
+// JSONPath evaluates the JSONPath expression (e.g. $.data.items[*].id) over the JSON
+// body of response. Body will be decoded only once, it's safe to be called concurrently.
+func (resp *Response) JSONPath(expr string) (interface{}, error) {
+	resp.jsonOnce.Do(func() {
+		if len(resp.Body) == 0 {
+			resp.jsonErr = errors.New("empty response body")
+			return
+		}
+
+		resp.jsonErr = json.Unmarshal(resp.Body, &resp.jsonBody)
+	})
+
+	if resp.jsonErr != nil {
+		return nil, resp.jsonErr
+	}
+
+	return jsonpath.Get(expr, resp.jsonBody)
+}
+
+// Re returns all matches of the regular expression in response body. For expression
+// with capturing groups, it returns the first submatch of all matches instead.
+func (resp *Response) Re(pattern string) ([]string, error) {
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	body := resp.Body
+	if len(body) == 0 && resp.Document != nil {
+		html, err := resp.Document.Html()
+		if err != nil {
+			return nil, err
+		}
+		body = []byte(html)
+	}
+
+	var res []string
+	for _, match := range reg.FindAllSubmatch(body, -1) {
+		if len(match) > 1 {
+			res = append(res, string(match[1]))
+			continue
+		}
+		res = append(res, string(match[0]))
+	}
+
+	return res, nil
+}
+
+// XPath returns all nodes matched by the XPath expression over response document.
+func (ctx *Context) XPath(expr string) ([]*html.Node, error) {
+	return ctx.Response().XPath(expr)
+}
+
+// XPathStrings returns the text of all nodes matched by the XPath expression.
+func (ctx *Context) XPathStrings(expr string) ([]string, error) {
+	return ctx.Response().XPathStrings(expr)
+}
+
+// JSONPath evaluates the JSONPath expression over response body.
+func (ctx *Context) JSONPath(expr string) (interface{}, error) {
+	return ctx.Response().JSONPath(expr)
+}
+
+// Re returns all matches of the regular expression in response body.
+func (ctx *Context) Re(pattern string) ([]string, error) {
+	return ctx.Response().Re(pattern)
+}
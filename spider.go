@@ -0,0 +1,380 @@
+package goscrapy
+
+import (
+	"context"
+	"crypto/sha1"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reasons of closing spider
+const (
+	CloseReasonFinished   = "finished"    // no more requests to crawl
+	CloseReasonShutdown   = "shutdown"    // engine has been stopped
+	CloseReasonOpenFailed = "open_failed" // failed to open spider
+)
+
+// SpiderOpener is an optional interface implemented by spiders that need to prepare
+// before crawling, e.g. logging in. Opened will be called before loading start requests,
+// spider will be closed with reason CloseReasonOpenFailed if Opened returns error.
+type SpiderOpener interface {
+	Opened(ctx context.Context) error
+}
+
+// SpiderCloser is an optional interface implemented by spiders that need to release
+// resources once spider is closed.
+type SpiderCloser interface {
+	Closed(ctx context.Context, reason string)
+}
+
+// IdleSpider is an optional interface implemented by spiders that want to add more
+// requests once all their requests have been handled. Spider will be closed with
+// reason CloseReasonFinished if Idle returns no request.
+type IdleSpider interface {
+	Idle(ctx context.Context) []*Request
+}
+
+// StartRequestStreamer is an optional interface implemented by spiders that have a
+// huge amount of start requests, e.g. seeding from a large file or a database cursor.
+// Instead of calling StartRequests, engine calls StreamStartRequests in a separate
+// goroutine and consumes requests sent to out lazily as the scheduler has room, so
+// that sending blocks until the request could be scheduled. StreamStartRequests
+// should return once all requests have been sent or ctx is done (e.g. spider has
+// been closed), out will be closed by engine after it returns.
+/* for example:
+func (s *Spider) StreamStartRequests(ctx context.Context, out chan<- *goscrapy.Request) error {
+	scanner := bufio.NewScanner(s.file)
+	for scanner.Scan() {
+		select {
+		case out <- &goscrapy.Request{URL: scanner.Text()}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
+*/
+type StartRequestStreamer interface {
+	StreamStartRequests(ctx context.Context, out chan<- *Request) error
+}
+
+// RecurringSpider is an optional interface implemented by spiders that crawl periodically.
+// Once a run has finished (i.e. all its requests have been handled and IdleSpider returns no
+// request), the spider will not be closed but run again at the next time of Schedule, which
+// reloads start requests. It only works with engine option KeepAlive, otherwise spiders run
+// once. Requests filtered as duplicates (see CanonicalizeURLs) are only filtered within a run,
+// so pages are crawled again by every run. BeginRun is called before loading start requests of
+// every run with run number starting from 1, spiders should reset their own states scoped to
+// one run there, e.g. counters of the run.
+/* for example:
+func (s *Spider) Schedule() goscrapy.Schedule {
+	return goscrapy.MustParseCron("0 * * * *") // hourly
+}
+
+func (s *Spider) BeginRun(ctx context.Context, run int) {
+	atomic.StoreInt64(&s.pages, 0)
+}
+*/
+type RecurringSpider interface {
+	Schedule() Schedule
+	BeginRun(ctx context.Context, run int)
+}
+
+// spiderState records the running state of spider.
+type spiderState struct {
+	spider Spider
+	// number of requests generated by spider but not handled yet, including
+	// holders (e.g. loading start requests) that keep spider from being idle.
+	pending int64
+	closed  int32 // 1 if spider has been closed
+	done    int32 // 1 if pipelines and spider have been notified of closing, see finishSpider
+	reason  string
+	mux     sync.Mutex // serializes idle handling and closing
+	ctx     context.Context
+	cancel  context.CancelFunc // cancels ctx once spider has been closed
+	run     int32              // current run number, see RecurringSpider
+	runAt   time.Time          // start time of current run
+	nextRun *time.Timer        // timer starting the next run, see RecurringSpider
+	budget  Budget             // budget of spider, see BudgetSpider
+	usage   budgetUsage
+	seen    map[[sha1.Size]byte]struct{} // fingerprints of scheduled requests, see CanonicalizeURLs
+	seenMux sync.Mutex
+}
+
+func (st *spiderState) isClosed() bool {
+	return atomic.LoadInt32(&st.closed) == 1
+}
+
+// openSpiders initializes states of all spiders and calls SpiderOpener.
+func (e *Engine) openSpiders(ctx context.Context) {
+	e.mux.Lock()
+	e.spiderStates = make(map[string]*spiderState, len(e.spiders))
+	for _, spider := range e.spiders {
+		sctx, cancel := context.WithCancel(ctx)
+		st := &spiderState{
+			spider: spider,
+			ctx:    sctx,
+			cancel: cancel,
+		}
+
+		if bs, ok := spider.(BudgetSpider); ok {
+			st.budget = bs.Budget()
+		}
+		e.spiderStates[spider.Name()] = st
+	}
+	e.mux.Unlock()
+
+	for _, st := range e.openedSpiders() {
+		opener, ok := st.spider.(SpiderOpener)
+		if !ok {
+			continue
+		}
+
+		if err := opener.Opened(ctx); err != nil {
+			e.lg.Errorf(ctx, "failed to open spider [%s]: %v", st.spider.Name(), err)
+			e.CloseSpider(st.spider.Name(), CloseReasonOpenFailed)
+		}
+	}
+}
+
+// CloseSpider closes the spider with reason while other spiders continue crawling. Requests
+// generated by a closed spider will be dropped, and the spider will no longer handle
+// responses. Pipelines are closed and SpiderCloser is called once requests being handled
+// (e.g. items passing through pipelines) have finished. Engine will stop once all spiders
+// have been closed.
+func (e *Engine) CloseSpider(name string, reason string) {
+	st := e.getSpiderState(name)
+	if st == nil {
+		return
+	}
+
+	st.mux.Lock()
+	if !atomic.CompareAndSwapInt32(&st.closed, 0, 1) {
+		st.mux.Unlock()
+		return
+	}
+	st.reason = reason
+
+	// releasing the holder of next run
+	if st.nextRun != nil && st.nextRun.Stop() {
+		atomic.AddInt64(&st.pending, -1)
+	}
+	st.mux.Unlock()
+	st.cancel()
+
+	e.lg.Infof(context.Background(), "closing spider [%s], reason: %s", name, reason)
+
+	if atomic.LoadInt64(&st.pending) <= 0 {
+		e.finishSpider(st)
+	}
+
+	if len(e.openedSpiders()) == 0 {
+		e.stop(CloseReasonFinished)
+	}
+}
+
+// finishSpider closes pipelines and notifies spider once spider has been closed and all its
+// requests have been handled or dropped, it's called only once for every spider.
+func (e *Engine) finishSpider(st *spiderState) {
+	if !st.isClosed() || !atomic.CompareAndSwapInt32(&st.done, 0, 1) {
+		return
+	}
+
+	st.mux.Lock()
+	reason := st.reason
+	st.mux.Unlock()
+
+	ctx := context.Background()
+	e.closePipelines(ctx, st.spider)
+	if closer, ok := st.spider.(SpiderCloser); ok {
+		closer.Closed(ctx, reason)
+	}
+}
+
+func (e *Engine) getSpiderState(name string) *spiderState {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+
+	return e.spiderStates[name]
+}
+
+// allSpiderStates returns states of all spiders.
+func (e *Engine) allSpiderStates() []*spiderState {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+
+	res := make([]*spiderState, 0, len(e.spiderStates))
+	for _, spider := range e.spiders {
+		if st, ok := e.spiderStates[spider.Name()]; ok {
+			res = append(res, st)
+		}
+	}
+
+	return res
+}
+
+// openedSpiders returns states of all spiders that have not been closed.
+func (e *Engine) openedSpiders() []*spiderState {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+
+	var res []*spiderState
+	for _, spider := range e.spiders {
+		st, ok := e.spiderStates[spider.Name()]
+		if ok && !st.isClosed() {
+			res = append(res, st)
+		}
+	}
+
+	return res
+}
+
+// isSpiderClosed returns true if the spider has been closed.
+func (e *Engine) isSpiderClosed(name string) bool {
+	st := e.getSpiderState(name)
+	return st != nil && st.isClosed()
+}
+
+// trackRequest records request as pending for the spider generating it.
+func (e *Engine) trackRequest(req *Request) {
+	if st := e.getSpiderState(req.spider); st != nil {
+		e.holdSpider(st)
+	}
+}
+
+// requestDone marks request as handled, spider will become idle once all its
+// requests have been handled.
+func (e *Engine) requestDone(ctx context.Context, req *Request) {
+	if st := e.getSpiderState(req.spider); st != nil {
+		e.releaseSpider(ctx, st)
+	}
+}
+
+// holdSpider keeps spider from being idle until releaseSpider is called.
+func (e *Engine) holdSpider(st *spiderState) {
+	atomic.AddInt64(&st.pending, 1)
+}
+
+// releaseSpider releases a pending request or holder of spider, spider will become
+// idle if nothing pending, or be finished if it has been closed.
+func (e *Engine) releaseSpider(ctx context.Context, st *spiderState) {
+	if atomic.AddInt64(&st.pending, -1) > 0 {
+		return
+	}
+
+	if st.isClosed() {
+		e.finishSpider(st)
+		return
+	}
+
+	e.spiderIdle(ctx, st)
+}
+
+// hasPendingRequests returns true if there are requests that have not been handled.
+func (e *Engine) hasPendingRequests() bool {
+	e.mux.RLock()
+	defer e.mux.RUnlock()
+
+	for _, st := range e.spiderStates {
+		if atomic.LoadInt64(&st.pending) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// spiderIdle handles idle spider, it returns true if spider generates more requests,
+// otherwise the spider will be closed.
+func (e *Engine) spiderIdle(ctx context.Context, st *spiderState) bool {
+	st.mux.Lock()
+	if st.isClosed() || atomic.LoadInt64(&st.pending) > 0 {
+		st.mux.Unlock()
+		return false
+	}
+
+	var reqs []*Request
+	if idle, ok := st.spider.(IdleSpider); ok {
+		reqs = e.prepareRequests(ctx, st.spider, idle.Idle(ctx), 1)
+	}
+
+	// scheduling under lock, so that the next run won't be scheduled twice
+	scheduled := len(reqs) == 0 && e.scheduleNextRun(ctx, st)
+	st.mux.Unlock()
+
+	if len(reqs) > 0 {
+		e.lg.Debugf(ctx, "spider [%s] is idle, adding %d new requests", st.spider.Name(), len(reqs))
+		go e.pushRequests(reqs)
+		return true
+	}
+
+	if scheduled {
+		return true
+	}
+
+	e.CloseSpider(st.spider.Name(), CloseReasonFinished)
+	return false
+}
+
+// startRun starts a new run of spider by loading start requests, spider should be held
+// before calling it.
+func (e *Engine) startRun(st *spiderState) {
+	if st.isClosed() || e.isStopped() {
+		e.releaseSpider(st.ctx, st)
+		return
+	}
+
+	run := atomic.AddInt32(&st.run, 1)
+
+	// runAt is read by scheduleNextRun under lock
+	st.mux.Lock()
+	st.runAt = time.Now()
+	st.mux.Unlock()
+
+	// requests of previous runs should be crawled again
+	st.seenMux.Lock()
+	st.seen = nil
+	st.seenMux.Unlock()
+
+	if recurring, ok := st.spider.(RecurringSpider); ok {
+		recurring.BeginRun(st.ctx, int(run))
+	}
+
+	e.loadStartRequests(st)
+}
+
+// scheduleNextRun schedules the next run of recurring spider, it returns false if spider
+// is not recurring or there is no next run. Spider is held until the next run starts,
+// which keeps engine alive.
+func (e *Engine) scheduleNextRun(ctx context.Context, st *spiderState) bool {
+	recurring, ok := st.spider.(RecurringSpider)
+	if !ok || !e.keepAlive {
+		return false
+	}
+
+	schedule := recurring.Schedule()
+	if schedule == nil {
+		return false
+	}
+
+	next := schedule.Next(st.runAt)
+	if next.IsZero() {
+		return false
+	}
+
+	// starting immediately if the run took longer than schedule
+	now := time.Now()
+	if next.Before(now) {
+		next = now
+	}
+
+	e.lg.Infof(ctx, "spider [%s] finished run %d, next run at %s", st.spider.Name(), atomic.LoadInt32(&st.run), next.Format(time.RFC3339))
+
+	e.holdSpider(st)
+	st.nextRun = time.AfterFunc(next.Sub(now), func() {
+		e.startRun(st)
+	})
+
+	return true
+}
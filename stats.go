@@ -0,0 +1,66 @@
+package goscrapy
+
+import "sync"
+
+// all built-in stats keys
+const (
+	StatItemScraped   = "item_scraped_count"   // items passed through all pipelines
+	StatItemDropped   = "item_dropped_count"   // items dropped by pipelines
+	StatPipelineError = "pipeline_error_count" // errors returned by pipelines, excluding dropping items
+
+	StatResponseReceived = "response_received_count" // responses received from downloader
+	StatResponseBytes    = "response_bytes"          // bytes of received response bodies
+	StatDownloadError    = "download_error_count"    // errors returned by downloader or request middlewares
+	StatSpiderError      = "spider_error_count"      // errors returned by spiders when parsing
+	StatRequestFiltered  = "request_filtered_count"  // duplicate requests dropped, see CanonicalizeURLs
+)
+
+// Stats collects crawling stats as named counters.
+type Stats struct {
+	mux    sync.RWMutex
+	values map[string]int64
+}
+
+// NewStats creates an empty stats.
+func NewStats() *Stats {
+	return &Stats{
+		values: make(map[string]int64),
+	}
+}
+
+// Inc increases the value of key by delta.
+func (s *Stats) Inc(key string, delta int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.values[key] += delta
+}
+
+// Set sets the value of key.
+func (s *Stats) Set(key string, value int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.values[key] = value
+}
+
+// Get returns the value of key.
+func (s *Stats) Get(key string) int64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.values[key]
+}
+
+// Snapshot returns a copy of all stats.
+func (s *Stats) Snapshot() map[string]int64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	res := make(map[string]int64, len(s.values))
+	for key, val := range s.values {
+		res[key] = val
+	}
+
+	return res
+}